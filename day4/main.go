@@ -3,10 +3,38 @@ package main
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"os"
+	"sort"
 	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	HighlightCase HighlightStyle = iota
+	HighlightANSI
+)
+
+const (
+	ansiHighlight = "\033[1;32m"
+	ansiReset     = "\033[0m"
+)
+
+const (
+	zeroWidthJoiner    = '\u200d'
+	emojiModifierFirst = '\U0001F3FB'
+	emojiModifierLast  = '\U0001F3FF'
+)
+
+const (
+	MatchExact         MatchMode = 0
+	MatchIgnoreCase    MatchMode = 1 << 0
+	MatchIgnoreAccents MatchMode = 1 << 1
 )
 
 const (
@@ -21,7 +49,10 @@ const (
 )
 
 var (
-	ErrInvalidGrid = errors.New("invalid grid")
+	ErrInvalidGrid    = errors.New("invalid grid")
+	ErrInvalidStencil = errors.New("invalid stencil")
+	ErrInvalidPuzzle  = errors.New("invalid puzzle")
+	ErrPuzzleNotFound = errors.New("no puzzle found")
 )
 
 // Direction indicates the direction of the pattern
@@ -30,20 +61,81 @@ type Direction int
 // Grid is a 2D array of strings that represents a word search puzzle
 type Grid [][]string
 
+// Contains checks if the coordinate is a cell of the grid.
+// Rows may differ in length, cells past the end of a row are treated as absent.
+func (g Grid) Contains(c Coordinate) bool {
+	return c.x >= 0 && c.x < len(g) && c.y >= 0 && c.y < len(g[c.x])
+}
+
 // IsPatternAt checks if the pattern is at the location in the grid
 func (g Grid) IsPatternAt(word string, pattern Pattern, atLocation Coordinate) bool {
+	return g.isPatternAt(splitLetters(word), pattern, atLocation, g.bounded)
+}
+
+// IsPatternAtWrapped checks if the pattern is at the location in the grid,
+// with the pattern wrapping around the edges of the grid as if it were a torus
+func (g Grid) IsPatternAtWrapped(word string, pattern Pattern, atLocation Coordinate) bool {
+	return g.isPatternAt(splitLetters(word), pattern, atLocation, g.wrapped)
+}
+
+// isPatternAt checks if the pattern is at the location, using locate to find each cell
+func (g Grid) isPatternAt(letters []string, pattern Pattern, atLocation Coordinate, locate locator) bool {
+	if len(letters) != len(pattern.coordinates) {
+		return false
+	}
 	// Check if the pattern is at the location
 	for i, c := range pattern.coordinates {
-		if atLocation.x+c.x < 0 || atLocation.x+c.x >= len(g) || atLocation.y+c.y < 0 || atLocation.y+c.y >= len(g[0]) {
+		cell, ok := locate(Coordinate{atLocation.x + c.x, atLocation.y + c.y})
+		if !ok {
 			return false
 		}
-		if g[atLocation.x+c.x][atLocation.y+c.y] != string(word[i]) {
+		if g[cell.x][cell.y] != letters[i] {
 			return false
 		}
 	}
 	return true
 }
 
+// fold returns a copy of the grid with every letter folded for the match mode
+func (g Grid) fold(mode MatchMode) Grid {
+	folded := make(Grid, len(g))
+	for i, row := range g {
+		folded[i] = mode.foldAll(row)
+	}
+	return folded
+}
+
+// locator finds the cell of the grid for a coordinate, if there is one
+type locator func(c Coordinate) (Coordinate, bool)
+
+// bounded treats the edge of the grid as a hard boundary
+func (g Grid) bounded(c Coordinate) (Coordinate, bool) {
+	return c, g.Contains(c)
+}
+
+// wrapped wraps the coordinate around the width and height of a rectangular grid
+func (g Grid) wrapped(c Coordinate) (Coordinate, bool) {
+	height, width := len(g), len(g[0])
+	return Coordinate{((c.x % height) + height) % height, ((c.y % width) + width) % width}, true
+}
+
+// Validate checks that the grid has at least one row and, unless ragged rows
+// are allowed, that every row is the same length as the first
+func (g Grid) Validate(ragged bool) error {
+	if len(g) == 0 {
+		return fmt.Errorf("%w: grid has no rows", ErrInvalidGrid)
+	}
+	if ragged {
+		return nil
+	}
+	for i, row := range g {
+		if len(row) != len(g[0]) {
+			return fmt.Errorf("%w: row %d has length %d, expected %d", ErrInvalidGrid, i, len(row), len(g[0]))
+		}
+	}
+	return nil
+}
+
 // Coordinate represents a location in 2D space
 type Coordinate struct {
 	x int
@@ -54,23 +146,50 @@ type Coordinate struct {
 type Match struct {
 	direction Direction
 	location  Coordinate
+	cells     []Coordinate
+}
+
+// Cells returns every cell of the grid covered by the match
+func (m Match) Cells() []Coordinate {
+	return m.cells
 }
 
-// Pattern represents a place that a word can take up in a 2D space
+// Pattern represents a place that a word can take up in a 2D space.
+// Patterns made from a Stencil are reflected when they are a mirror image of it.
 type Pattern struct {
 	direction   Direction
+	reflected   bool
 	coordinates []Coordinate
 }
 
-// Word represents a word that can be found in a word search puzzle
+// cellsAt returns the cells the pattern covers when started at the location,
+// each cell only once even if the pattern visits it more than once
+func (p Pattern) cellsAt(atLocation Coordinate, locate locator) []Coordinate {
+	cells := []Coordinate{}
+	seen := map[Coordinate]bool{}
+	for _, c := range p.coordinates {
+		cell, _ := locate(Coordinate{atLocation.x + c.x, atLocation.y + c.y})
+		if seen[cell] {
+			continue
+		}
+		seen[cell] = true
+		cells = append(cells, cell)
+	}
+	return cells
+}
+
+// Word represents a word that can be found in a word search puzzle.
+// Its letters are grapheme clusters, so accented or non-Latin words fill
+// one cell of the grid per letter just as plain ASCII words do.
 type Word struct {
 	word    string
+	letters []string
 	pattern []Pattern
 }
 
 // NewWord creates a new Word and all possible patterns for the word
 func NewWord(w string) *Word {
-	word := &Word{word: w}
+	word := &Word{word: w, letters: splitLetters(w)}
 
 	// Calculate all possible Positions
 	word.createFlatPattern(DirectionEast)
@@ -87,7 +206,7 @@ func NewWord(w string) *Word {
 
 // NewXWord creates a new Word and all possible X patterns for the word
 func NewXWord(w string) *Word {
-	word := &Word{word: w}
+	word := &Word{word: w, letters: splitLetters(w)}
 
 	// Calculate all possible Positions
 	word.createCrossPattern(DirectionEast)
@@ -97,6 +216,7 @@ func NewXWord(w string) *Word {
 
 	// Double the word to allow for matching chars to both words in the X
 	word.word = word.word + word.word
+	word.letters = append(word.letters, word.letters...)
 
 	return word
 }
@@ -106,7 +226,7 @@ func (w *Word) createFlatPattern(direction Direction) {
 	// Create a Pattern based on the direction and start location
 	p := Pattern{direction: direction}
 	c := []Coordinate{}
-	for i := 0; i < len(w.word); i++ {
+	for i := 0; i < len(w.letters); i++ {
 		switch direction {
 		case DirectionEast:
 			c = append(c, Coordinate{0, 0 + i})
@@ -135,9 +255,9 @@ func (w *Word) createCrossPattern(direction Direction) {
 	// Create a Pattern based on the direction and start location
 	p := Pattern{direction: direction}
 	c := []Coordinate{}
-	offset := len(w.word) - 1
+	offset := len(w.letters) - 1
 	// CRISS
-	for i := 0; i < len(w.word); i++ {
+	for i := 0; i < len(w.letters); i++ {
 		switch direction {
 		case DirectionEast:
 			c = append(c, Coordinate{0 + i, 0 + i})
@@ -150,7 +270,7 @@ func (w *Word) createCrossPattern(direction Direction) {
 		}
 	}
 	// CROSS
-	for i := 0; i < len(w.word); i++ {
+	for i := 0; i < len(w.letters); i++ {
 		switch direction {
 		case DirectionEast:
 			c = append(c, Coordinate{offset - i, 0 + i})
@@ -166,30 +286,255 @@ func (w *Word) createCrossPattern(direction Direction) {
 	w.pattern = append(w.pattern, p)
 }
 
+// NewStencilWord creates a new Word laid out in the shape of the stencil,
+// with a pattern for every distinct rotation and reflection of the stencil
+func NewStencilWord(w string, s Stencil) (*Word, error) {
+	word := &Word{}
+
+	// Every pattern visits the stencil cells in the same order,
+	// so the letters to match are the same for all of them
+	wordLetters := splitLetters(w)
+	for _, c := range s.cells {
+		if c.index >= len(wordLetters) {
+			return &Word{}, fmt.Errorf("%w: mark %d is past the end of %q", ErrInvalidStencil, c.index, w)
+		}
+		word.letters = append(word.letters, wordLetters[c.index])
+	}
+	word.word = strings.Join(word.letters, "")
+
+	// Calculate all possible Positions
+	word.createStencilPattern(s, DirectionEast, 0, false)
+	word.createStencilPattern(s, DirectionSouth, 1, false)
+	word.createStencilPattern(s, DirectionWest, 2, false)
+	word.createStencilPattern(s, DirectionNorth, 3, false)
+	word.createStencilPattern(s, DirectionEast, 0, true)
+	word.createStencilPattern(s, DirectionSouth, 1, true)
+	word.createStencilPattern(s, DirectionWest, 2, true)
+	word.createStencilPattern(s, DirectionNorth, 3, true)
+
+	return word, nil
+}
+
+// createStencilPattern creates a pattern for the word from the stencil turned
+// clockwise by the number of quarter turns, mirrored first if reflected.
+// Patterns that land on the same cells as an existing pattern are skipped.
+func (w *Word) createStencilPattern(s Stencil, direction Direction, quarterTurns int, reflected bool) {
+	p := Pattern{direction: direction, reflected: reflected}
+	c := []Coordinate{}
+	for _, cell := range s.cells {
+		at := cell.at
+		if reflected {
+			at = Coordinate{at.x, -at.y}
+		}
+		for i := 0; i < quarterTurns; i++ {
+			at = Coordinate{at.y, -at.x}
+		}
+		c = append(c, at)
+	}
+
+	// Move the pattern back so its top left corner is at the start location
+	minX, minY := c[0].x, c[0].y
+	for _, at := range c {
+		minX = min(minX, at.x)
+		minY = min(minY, at.y)
+	}
+	for i := range c {
+		c[i] = Coordinate{c[i].x - minX, c[i].y - minY}
+	}
+	p.coordinates = c
+
+	for _, existing := range w.pattern {
+		if s.sameShape(existing.coordinates, p.coordinates) {
+			return
+		}
+	}
+	w.pattern = append(w.pattern, p)
+}
+
+// Stencil is a shape, drawn in ASCII, that a word can be laid out in.
+// Each marked cell holds the index of the letter of the word that goes there,
+// 0-9 then a-z, and '.' or ' ' leaves a cell empty. An index can be marked
+// more than once, so shapes such as an X can share a letter between strokes.
+//
+// For example the X-MAS shape is:
+//
+//	0.0
+//	.1.
+//	2.2
+type Stencil struct {
+	cells []stencilCell
+}
+
+// stencilCell is a marked cell of a stencil
+type stencilCell struct {
+	at    Coordinate
+	index int
+}
+
+// ParseStencil creates a Stencil from its ASCII drawing.
+// Blank lines before and after the drawing are ignored.
+func ParseStencil(drawing string) (Stencil, error) {
+	s := Stencil{}
+	lines := strings.Split(strings.Trim(strings.ReplaceAll(drawing, "\r\n", "\n"), "\n"), "\n")
+	for x, line := range lines {
+		for y, r := range []rune(line) {
+			if r == '.' || r == ' ' {
+				continue
+			}
+			index, ok := stencilIndex(r)
+			if !ok {
+				return Stencil{}, fmt.Errorf("%w: unknown mark %q at row %d column %d", ErrInvalidStencil, r, x, y)
+			}
+			s.cells = append(s.cells, stencilCell{at: Coordinate{x, y}, index: index})
+		}
+	}
+	if len(s.cells) == 0 {
+		return Stencil{}, fmt.Errorf("%w: no cells marked", ErrInvalidStencil)
+	}
+	return s, nil
+}
+
+// stencilIndex converts a stencil mark to the index of a letter in a word
+func stencilIndex(r rune) (int, bool) {
+	switch {
+	case r >= '0' && r <= '9':
+		return int(r - '0'), true
+	case r >= 'a' && r <= 'z':
+		return int(r-'a') + 10, true
+	}
+	return 0, false
+}
+
+// sameShape checks if two layouts of the stencil cover the same cells with the same letters
+func (s Stencil) sameShape(a, b []Coordinate) bool {
+	indexAt := map[Coordinate]int{}
+	for i, at := range a {
+		indexAt[at] = s.cells[i].index
+	}
+	for i, at := range b {
+		index, ok := indexAt[at]
+		if !ok || index != s.cells[i].index {
+			return false
+		}
+	}
+	return true
+}
+
 // WordSearch represents a word search puzzle
 type WordSearch struct {
-	grid Grid
+	grid   Grid
+	wrap   bool
+	mode   MatchMode
+	folded Grid
+}
+
+// SetMatchMode changes how letters of the grid are compared with letters of words
+func (ws *WordSearch) SetMatchMode(mode MatchMode) {
+	ws.mode = mode
+	ws.folded = nil
+	if mode != MatchExact {
+		ws.folded = ws.grid.fold(mode)
+	}
+}
+
+// searchGrid returns the grid that words are matched against,
+// which is folded when the search is not exact
+func (ws *WordSearch) searchGrid() Grid {
+	if ws.folded != nil {
+		return ws.folded
+	}
+	return ws.grid
 }
 
-// NewWordSearch creates a new WordSearch
+// NewWordSearch creates a new WordSearch for a rectangular grid
 func NewWordSearch(g Grid) (*WordSearch, error) {
-	// if length of one dimension is not the same as the other, return an error
+	// if any row is not the same length as the first, return an error
+	if err := g.Validate(false); err != nil {
+		return &WordSearch{}, err
+	}
 	log.Println("Creating wordsearch for grid of size:", len(g), "x", len(g[0]))
-	if len(g) != len(g[0]) {
-		return &WordSearch{}, ErrInvalidGrid
+	return &WordSearch{grid: g}, nil
+}
+
+// NewRaggedWordSearch creates a new WordSearch for a grid whose rows may differ in length
+func NewRaggedWordSearch(g Grid) (*WordSearch, error) {
+	if err := g.Validate(true); err != nil {
+		return &WordSearch{}, err
 	}
+	log.Println("Creating ragged wordsearch for grid with rows:", len(g))
 	return &WordSearch{grid: g}, nil
 }
 
+// NewToroidalWordSearch creates a new WordSearch for a rectangular grid whose
+// edges wrap around, so words can run off one side and continue on the other
+func NewToroidalWordSearch(g Grid) (*WordSearch, error) {
+	if err := g.Validate(false); err != nil {
+		return &WordSearch{}, err
+	}
+	log.Println("Creating toroidal wordsearch for grid of size:", len(g), "x", len(g[0]))
+	return &WordSearch{grid: g, wrap: true}, nil
+}
+
+// locate finds the cell of the grid for a coordinate, wrapping if the search does
+func (ws *WordSearch) locate(c Coordinate) (Coordinate, bool) {
+	if ws.wrap {
+		return ws.grid.wrapped(c)
+	}
+	return ws.grid.bounded(c)
+}
+
+// sameInstance checks if a match reads the same cells, stepping the same way,
+// as one already seen. A palindrome reads the same backwards, so the same cells
+// read in reverse are the same instance. On a wrapping grid a word can also wrap
+// onto itself, so that starting from another cell, or even another direction,
+// reads it again.
+func (ws *WordSearch) sameInstance(seen map[string]bool, pattern Pattern, cells []Coordinate) bool {
+	sorted := append([]Coordinate{}, cells...)
+	sort.Slice(sorted, func(a, b int) bool {
+		if sorted[a].x != sorted[b].x {
+			return sorted[a].x < sorted[b].x
+		}
+		return sorted[a].y < sorted[b].y
+	})
+	forward, backward := []Coordinate{}, []Coordinate{}
+	for i := 1; i < len(pattern.coordinates); i++ {
+		step := Coordinate{pattern.coordinates[i].x - pattern.coordinates[i-1].x, pattern.coordinates[i].y - pattern.coordinates[i-1].y}
+		forward = append(forward, ws.normaliseStep(step))
+		backward = append([]Coordinate{ws.normaliseStep(Coordinate{-step.x, -step.y})}, backward...)
+	}
+	key := fmt.Sprint(sorted, forward)
+	if seen[key] || seen[fmt.Sprint(sorted, backward)] {
+		return true
+	}
+	seen[key] = true
+	return false
+}
+
+// normaliseStep wraps a step between letters onto the grid, so steps that land on the same
+// cell of a wrapping grid compare equal
+func (ws *WordSearch) normaliseStep(step Coordinate) Coordinate {
+	if ws.wrap {
+		step, _ = ws.grid.wrapped(step)
+	}
+	return step
+}
+
 // FindWord finds all occurances of a word in a grid
 func (ws *WordSearch) FindWord(w *Word) *[]Match {
 	log.Println("Finding word:", w.word)
 	matches := &[]Match{}
-	for i := 0; i < len(ws.grid); i++ {
-		for j := 0; j < len(ws.grid[i]); j++ {
+	seen := map[string]bool{}
+	grid := ws.searchGrid()
+	letters := ws.mode.foldAll(w.letters)
+	for i := 0; i < len(grid); i++ {
+		for j := 0; j < len(grid[i]); j++ {
 			for _, p := range w.pattern {
-				if ws.grid.IsPatternAt(w.word, p, Coordinate{i, j}) {
-					match := Match{direction: p.direction, location: Coordinate{i, j}}
+				if grid.isPatternAt(letters, p, Coordinate{i, j}, ws.locate) {
+					cells := p.cellsAt(Coordinate{i, j}, ws.locate)
+					if ws.sameInstance(seen, p, cells) {
+						continue
+					}
+					match := Match{direction: p.direction, location: Coordinate{i, j}, cells: cells}
 					*matches = append(*matches, match)
 				}
 			}
@@ -199,6 +544,457 @@ func (ws *WordSearch) FindWord(w *Word) *[]Match {
 	return matches
 }
 
+// FindWords finds all occurances of several words in a grid in a single pass.
+// The patterns of every word are merged into a shared prefix trie so each cell
+// of the grid is only visited once, however many words are being searched for.
+// Matches are grouped by word and ordered as FindWord would return them.
+func (ws *WordSearch) FindWords(words []*Word) map[*Word]*[]Match {
+	log.Println("Finding words:", len(words))
+	trie := newPatternTrie(words, ws.mode)
+
+	found := map[*Word][]trieMatch{}
+	grid := ws.searchGrid()
+	for i := 0; i < len(grid); i++ {
+		for j := 0; j < len(grid[i]); j++ {
+			trie.root.walk(grid, Coordinate{i, j}, ws.locate, found)
+		}
+	}
+
+	results := map[*Word]*[]Match{}
+	for _, w := range words {
+		candidates := found[w]
+		sort.SliceStable(candidates, func(a, b int) bool {
+			if candidates[a].location.x != candidates[b].location.x {
+				return candidates[a].location.x < candidates[b].location.x
+			}
+			if candidates[a].location.y != candidates[b].location.y {
+				return candidates[a].location.y < candidates[b].location.y
+			}
+			return candidates[a].pattern < candidates[b].pattern
+		})
+		matches := &[]Match{}
+		seen := map[string]bool{}
+		for _, c := range candidates {
+			p := w.pattern[c.pattern]
+			cells := p.cellsAt(c.location, ws.locate)
+			if ws.sameInstance(seen, p, cells) {
+				continue
+			}
+			*matches = append(*matches, Match{direction: p.direction, location: c.location, cells: cells})
+		}
+		results[w] = matches
+		log.Println("Matches found for", w.word, ":", len(*matches))
+	}
+	return results
+}
+
+// HighlightStyle indicates how matched letters are shown when rendering a grid
+type HighlightStyle int
+
+// Render writes the grid with the letters of every match of every word highlighted
+func (ws *WordSearch) Render(out io.Writer, results map[*Word]*[]Match, style HighlightStyle) error {
+	matches := []Match{}
+	for _, m := range results {
+		matches = append(matches, *m...)
+	}
+	return ws.grid.Render(out, matches, style)
+}
+
+// RenderWord writes the grid with only the letters of the matches of a single word highlighted
+func (ws *WordSearch) RenderWord(out io.Writer, results map[*Word]*[]Match, w *Word, style HighlightStyle) error {
+	matches := []Match{}
+	if m, ok := results[w]; ok {
+		matches = *m
+	}
+	return ws.grid.Render(out, matches, style)
+}
+
+// Render writes the grid with the letters covered by the matches highlighted
+// and every other cell dimmed to a '.'
+func (g Grid) Render(out io.Writer, matches []Match, style HighlightStyle) error {
+	covered := map[Coordinate]bool{}
+	for _, m := range matches {
+		for _, c := range m.Cells() {
+			covered[c] = true
+		}
+	}
+
+	for i, row := range g {
+		var line strings.Builder
+		for j, cell := range row {
+			if !covered[Coordinate{i, j}] {
+				line.WriteString(".")
+				continue
+			}
+			switch style {
+			case HighlightANSI:
+				line.WriteString(ansiHighlight + cell + ansiReset)
+			default:
+				line.WriteString(strings.ToUpper(cell))
+			}
+		}
+		if _, err := fmt.Fprintln(out, line.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patternTrie is a prefix tree over the patterns of many words.
+// Each edge is a letter at an offset from the start location, so patterns that
+// begin with the same letters in the same places share nodes.
+type patternTrie struct {
+	root *patternTrieNode
+}
+
+// patternTrieNode is a single step along one or more patterns
+type patternTrieNode struct {
+	offset    Coordinate
+	letter    string
+	children  []*patternTrieNode
+	terminals []patternTrieTerminal
+}
+
+// patternTrieTerminal records a pattern of a word that ends at a node
+type patternTrieTerminal struct {
+	word    *Word
+	pattern int
+}
+
+// trieMatch is a match found by the trie before it is grouped by word
+type trieMatch struct {
+	location Coordinate
+	pattern  int
+}
+
+// newPatternTrie builds a trie from every pattern of every word, with letters
+// folded for the match mode. A word given more than once is only added once.
+func newPatternTrie(words []*Word, mode MatchMode) *patternTrie {
+	t := &patternTrie{root: &patternTrieNode{}}
+	seen := map[*Word]bool{}
+	for _, w := range words {
+		if seen[w] {
+			continue
+		}
+		seen[w] = true
+		letters := mode.foldAll(w.letters)
+		for pi, p := range w.pattern {
+			if len(p.coordinates) != len(letters) {
+				continue
+			}
+			node := t.root
+			for i, c := range p.coordinates {
+				node = node.child(c, letters[i])
+			}
+			node.terminals = append(node.terminals, patternTrieTerminal{word: w, pattern: pi})
+		}
+	}
+	return t
+}
+
+// child returns the child for the letter at the offset, creating it if needed
+func (n *patternTrieNode) child(offset Coordinate, letter string) *patternTrieNode {
+	for _, c := range n.children {
+		if c.offset == offset && c.letter == letter {
+			return c
+		}
+	}
+	c := &patternTrieNode{offset: offset, letter: letter}
+	n.children = append(n.children, c)
+	return c
+}
+
+// walk follows every child that matches the grid from the location,
+// recording a match for each pattern that ends along the way
+func (n *patternTrieNode) walk(g Grid, atLocation Coordinate, locate locator, found map[*Word][]trieMatch) {
+	for _, t := range n.terminals {
+		found[t.word] = append(found[t.word], trieMatch{location: atLocation, pattern: t.pattern})
+	}
+	for _, c := range n.children {
+		cell, ok := locate(Coordinate{atLocation.x + c.offset.x, atLocation.y + c.offset.y})
+		if ok && g[cell.x][cell.y] == c.letter {
+			c.walk(g, atLocation, locate, found)
+		}
+	}
+}
+
+// maxGenerateAttempts limits how many times a Generator lays out a puzzle
+// before giving up on finding one where every word appears exactly once
+const maxGenerateAttempts = 100
+
+// maxPlacements limits how many times a Generator puts a word into the grid while laying out
+// a puzzle, as backtracking through words that do not fit can take far too long to finish
+const maxPlacements = 100000
+
+// Generator creates word search puzzles that hide a list of words
+type Generator struct {
+	words      []*Word
+	rows       int
+	columns    int
+	directions []Direction
+	letters    []string
+	rng        *rand.Rand
+	// placements is how many more times a word can be put into the grid on this attempt
+	placements int
+}
+
+// NewGenerator creates a new Generator for a grid of the given size that
+// places words only in the allowed directions. The same seed always
+// generates the same puzzle.
+func NewGenerator(words []string, rows, columns int, directions []Direction, seed int64) (*Generator, error) {
+	if rows < 1 || columns < 1 {
+		return &Generator{}, fmt.Errorf("%w: grid size %d x %d", ErrInvalidPuzzle, rows, columns)
+	}
+	if len(directions) == 0 {
+		return &Generator{}, fmt.Errorf("%w: no directions allowed", ErrInvalidPuzzle)
+	}
+	if len(words) == 0 {
+		return &Generator{}, fmt.Errorf("%w: no words to place", ErrInvalidPuzzle)
+	}
+
+	g := &Generator{rows: rows, columns: columns, directions: directions, rng: rand.New(rand.NewSource(seed))}
+	seen := map[string]bool{}
+	seenLetter := map[string]bool{}
+	for _, w := range words {
+		// A word can only appear exactly once if it can't be read backwards
+		// and isn't hidden inside another word
+		letters := splitLetters(w)
+		if len(letters) == 0 || w == reverse(letters) {
+			return &Generator{}, fmt.Errorf("%w: %q reads the same both ways", ErrInvalidPuzzle, w)
+		}
+		for _, other := range words {
+			if other != w && (strings.Contains(other, w) || strings.Contains(reverse(splitLetters(other)), w)) {
+				return &Generator{}, fmt.Errorf("%w: %q is part of %q", ErrInvalidPuzzle, w, other)
+			}
+		}
+		if seen[w] {
+			return &Generator{}, fmt.Errorf("%w: %q is listed twice", ErrInvalidPuzzle, w)
+		}
+		seen[w] = true
+		g.words = append(g.words, NewWord(w))
+
+		// Fill the grid with the same letters the words use
+		for _, l := range letters {
+			if !seenLetter[l] {
+				seenLetter[l] = true
+				g.letters = append(g.letters, l)
+			}
+		}
+	}
+
+	// Place the longest words first as they have the fewest places to go
+	sort.SliceStable(g.words, func(a, b int) bool {
+		return len(g.words[a].letters) > len(g.words[b].letters)
+	})
+	return g, nil
+}
+
+// Generate creates a puzzle where every word appears exactly once
+func (g *Generator) Generate() (Grid, error) {
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		grid := make(Grid, g.rows)
+		for i := range grid {
+			grid[i] = make([]string, g.columns)
+		}
+		g.placements = maxPlacements
+		if !g.place(grid, 0) {
+			if g.placements == 0 {
+				return Grid{}, fmt.Errorf("%w: gave up fitting words in a %d x %d grid after %d placements", ErrPuzzleNotFound, g.rows, g.columns, maxPlacements)
+			}
+			return Grid{}, fmt.Errorf("%w: words do not fit in a %d x %d grid", ErrPuzzleNotFound, g.rows, g.columns)
+		}
+		g.fill(grid)
+		if g.verify(grid) {
+			return grid, nil
+		}
+	}
+	return Grid{}, fmt.Errorf("%w: after %d attempts", ErrPuzzleNotFound, maxGenerateAttempts)
+}
+
+// place puts each word from the index onwards into the grid, backtracking
+// when a word has nowhere left to go. Words may cross where letters agree.
+// It gives up once the placements left for the attempt run out.
+func (g *Generator) place(grid Grid, index int) bool {
+	if index == len(g.words) {
+		return true
+	}
+	w := g.words[index]
+
+	type candidate struct {
+		location Coordinate
+		pattern  Pattern
+	}
+	candidates := []candidate{}
+	for _, p := range w.pattern {
+		if !g.allowed(p.direction) {
+			continue
+		}
+		for i := 0; i < g.rows; i++ {
+			for j := 0; j < g.columns; j++ {
+				if g.fits(grid, w, p, Coordinate{i, j}) {
+					candidates = append(candidates, candidate{Coordinate{i, j}, p})
+				}
+			}
+		}
+	}
+	g.rng.Shuffle(len(candidates), func(a, b int) {
+		candidates[a], candidates[b] = candidates[b], candidates[a]
+	})
+
+	for _, c := range candidates {
+		if g.placements == 0 {
+			return false
+		}
+		g.placements--
+
+		// Remember which cells were empty so they can be cleared again
+		placed := []Coordinate{}
+		for i, offset := range c.pattern.coordinates {
+			cell := Coordinate{c.location.x + offset.x, c.location.y + offset.y}
+			if grid[cell.x][cell.y] == "" {
+				grid[cell.x][cell.y] = w.letters[i]
+				placed = append(placed, cell)
+			}
+		}
+		if g.place(grid, index+1) {
+			return true
+		}
+		for _, cell := range placed {
+			grid[cell.x][cell.y] = ""
+		}
+	}
+	return false
+}
+
+// allowed checks if words may be placed in the direction
+func (g *Generator) allowed(direction Direction) bool {
+	for _, d := range g.directions {
+		if d == direction {
+			return true
+		}
+	}
+	return false
+}
+
+// fits checks if the word can be placed at the location without going off the
+// grid or changing a letter that is already there
+func (g *Generator) fits(grid Grid, w *Word, p Pattern, atLocation Coordinate) bool {
+	for i, offset := range p.coordinates {
+		cell := Coordinate{atLocation.x + offset.x, atLocation.y + offset.y}
+		if !grid.Contains(cell) {
+			return false
+		}
+		if grid[cell.x][cell.y] != "" && grid[cell.x][cell.y] != w.letters[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fill puts a random letter in every empty cell of the grid
+func (g *Generator) fill(grid Grid) {
+	for i := range grid {
+		for j := range grid[i] {
+			if grid[i][j] == "" {
+				grid[i][j] = g.letters[g.rng.Intn(len(g.letters))]
+			}
+		}
+	}
+}
+
+// verify checks that every word appears exactly once in the grid
+func (g *Generator) verify(grid Grid) bool {
+	ws, err := NewWordSearch(grid)
+	if err != nil {
+		return false
+	}
+	for _, w := range g.words {
+		if len(*ws.FindWord(w)) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// reverse returns the letters joined in reverse order
+func reverse(letters []string) string {
+	var b strings.Builder
+	for i := len(letters) - 1; i >= 0; i-- {
+		b.WriteString(letters[i])
+	}
+	return b.String()
+}
+
+// MatchMode indicates how letters are compared when searching for words.
+// Modes can be combined, such as MatchIgnoreCase | MatchIgnoreAccents.
+type MatchMode int
+
+// strokeFolds maps letters with a stroke or other mark that is part of the letter, rather than
+// a separate accent that Unicode can decompose, to the letter without it
+var strokeFolds = map[rune]rune{
+	'Đ': 'D', 'đ': 'd',
+	'Ħ': 'H', 'ħ': 'h',
+	'ı': 'i',
+	'Ŀ': 'L', 'ŀ': 'l', 'Ł': 'L', 'ł': 'l',
+	'Ø': 'O', 'ø': 'o',
+	'Ŧ': 'T', 'ŧ': 't',
+}
+
+// fold returns the letter as it should be compared in the match mode
+//
+// Accents are ignored by decomposing the letter and dropping the combining accents, so a
+// precomposed letter and the same letter written with combining accents fold the same way.
+func (m MatchMode) fold(letter string) string {
+	if m&MatchIgnoreAccents != 0 {
+		var b strings.Builder
+		for _, r := range norm.NFD.String(letter) {
+			if unicode.Is(unicode.Mn, r) {
+				continue
+			}
+			if base, ok := strokeFolds[r]; ok {
+				r = base
+			}
+			b.WriteRune(r)
+		}
+		letter = norm.NFC.String(b.String())
+	}
+	if m&MatchIgnoreCase != 0 {
+		letter = strings.ToLower(letter)
+	}
+	return letter
+}
+
+// foldAll returns the letters as they should be compared in the match mode
+func (m MatchMode) foldAll(letters []string) []string {
+	if m == MatchExact {
+		return letters
+	}
+	folded := make([]string, len(letters))
+	for i, l := range letters {
+		folded[i] = m.fold(l)
+	}
+	return folded
+}
+
+// splitLetters splits a string into the letters a reader would see,
+// keeping combining marks, variation selectors and joined emoji with the
+// letter before them rather than giving them a cell of their own
+func splitLetters(s string) []string {
+	letters := []string{}
+	joinNext := false
+	for _, r := range s {
+		joins := unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc, unicode.Variation_Selector) ||
+			r == zeroWidthJoiner || (r >= emojiModifierFirst && r <= emojiModifierLast)
+		if len(letters) > 0 && (joins || joinNext) {
+			letters[len(letters)-1] += string(r)
+		} else {
+			letters = append(letters, string(r))
+		}
+		joinNext = r == zeroWidthJoiner
+	}
+	return letters
+}
+
 func main() {
 	// read the inputs
 	inputFile, err := os.Open("input.txt")
@@ -239,7 +1035,7 @@ func createGrid(inputFile io.Reader) (Grid, error) {
 	grid := Grid{}
 	for scanner.Scan() {
 		line := scanner.Text()
-		row := strings.Split(line, "")
+		row := splitLetters(line)
 		grid = append(grid, row)
 	}
 	return grid, nil
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"strings"
 	"testing"
@@ -33,12 +34,18 @@ var (
 		{".", "A", "."},
 		{"M", ".", "S"},
 	}
-	invalidTestGrid = Grid{
+	rectangularTestGrid = Grid{
 		{"M", "M", "M", "S", "X", "X", "M", "A", "S", "M"},
 		{"M", "S", "A", "M", "X", "M", "S", "M", "S", "A"},
 		{"A", "M", "X", "S", "X", "M", "A", "A", "M", "M"},
 		{"M", "S", "A", "M", "A", "S", "M", "S", "M", "X"},
 	}
+	raggedTestGrid = Grid{
+		{"X", "M", "A", "S"},
+		{"M", "M"},
+		{"A", ".", "."},
+		{"S", ".", ".", "S"},
+	}
 )
 
 func TestDay4_WordSearch_NewWordsearch(t *testing.T) {
@@ -49,7 +56,9 @@ func TestDay4_WordSearch_NewWordsearch(t *testing.T) {
 		expectedErr error
 	}{
 		{"valid_grid", validTestGridPart1, &WordSearch{grid: validTestGridPart1}, nil},
-		{"invalid_grid", invalidTestGrid, &WordSearch{}, ErrInvalidGrid},
+		{"rectangular_grid", rectangularTestGrid, &WordSearch{grid: rectangularTestGrid}, nil},
+		{"ragged_grid", raggedTestGrid, &WordSearch{}, ErrInvalidGrid},
+		{"empty_grid", Grid{}, &WordSearch{}, ErrInvalidGrid},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -60,13 +69,37 @@ func TestDay4_WordSearch_NewWordsearch(t *testing.T) {
 	}
 }
 
+func TestDay4_WordSearch_NewWordsearchErrorNamesRow(t *testing.T) {
+	_, err := NewWordSearch(raggedTestGrid)
+	assert.EqualError(t, err, "invalid grid: row 1 has length 2, expected 4")
+}
+
+func TestDay4_WordSearch_NewRaggedWordsearch(t *testing.T) {
+	tests := []struct {
+		name        string
+		grid        [][]string
+		expected    *WordSearch
+		expectedErr error
+	}{
+		{"ragged_grid", raggedTestGrid, &WordSearch{grid: raggedTestGrid}, nil},
+		{"empty_grid", Grid{}, &WordSearch{}, ErrInvalidGrid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := NewRaggedWordSearch(test.grid)
+			assert.Equal(t, test.expected, result)
+			assert.ErrorIs(t, err, test.expectedErr)
+		})
+	}
+}
+
 func TestDay4_Word_NewWord(t *testing.T) {
 	tests := []struct {
 		name     string
 		word     string
 		expected *Word
 	}{
-		{"valid_word", "XMAS", &Word{word: "XMAS", pattern: []Pattern{
+		{"valid_word", "XMAS", &Word{word: "XMAS", letters: []string{"X", "M", "A", "S"}, pattern: []Pattern{
 			{direction: DirectionEast, coordinates: []Coordinate{{0, 0}, {0, 1}, {0, 2}, {0, 3}}},
 			{direction: DirectionSouthEast, coordinates: []Coordinate{{0, 0}, {1, 1}, {2, 2}, {3, 3}}},
 			{direction: DirectionSouth, coordinates: []Coordinate{{0, 0}, {1, 0}, {2, 0}, {3, 0}}},
@@ -91,7 +124,7 @@ func TestDay4_Word_NewXWord(t *testing.T) {
 		word     string
 		expected *Word
 	}{
-		{"valid_word", "MAS", &Word{word: "MASMAS", pattern: []Pattern{
+		{"valid_word", "MAS", &Word{word: "MASMAS", letters: []string{"M", "A", "S", "M", "A", "S"}, pattern: []Pattern{
 			{direction: DirectionEast, coordinates: []Coordinate{{0, 0}, {1, 1}, {2, 2}, {2, 0}, {1, 1}, {0, 2}}},
 			{direction: DirectionSouth, coordinates: []Coordinate{{0, 0}, {1, 1}, {2, 2}, {0, 2}, {1, 1}, {2, 0}}},
 			{direction: DirectionWest, coordinates: []Coordinate{{0, 2}, {1, 1}, {2, 0}, {2, 2}, {1, 1}, {0, 0}}},
@@ -135,8 +168,16 @@ func TestDay4_WordSearch_FindWord(t *testing.T) {
 		grid     Grid
 		expected *[]Match
 	}{
-		{"match word", NewWord("XMAS"), validSmallTestGridPart1, &[]Match{{DirectionWest, Coordinate{1, 4}}, {DirectionEast, Coordinate{4, 0}}}},
+		{"match word", NewWord("XMAS"), validSmallTestGridPart1, &[]Match{
+			{DirectionWest, Coordinate{1, 4}, []Coordinate{{1, 4}, {1, 3}, {1, 2}, {1, 1}}},
+			{DirectionEast, Coordinate{4, 0}, []Coordinate{{4, 0}, {4, 1}, {4, 2}, {4, 3}}},
+		}},
 		{"no match", NewWord("TR"), validSmallTestGridPart1, &[]Match{}},
+		{"match rectangular", NewWord("XMAS"), rectangularTestGrid, &[]Match{
+			{DirectionSouthEast, Coordinate{0, 4}, []Coordinate{{0, 4}, {1, 5}, {2, 6}, {3, 7}}},
+			{DirectionEast, Coordinate{0, 5}, []Coordinate{{0, 5}, {0, 6}, {0, 7}, {0, 8}}},
+			{DirectionWest, Coordinate{1, 4}, []Coordinate{{1, 4}, {1, 3}, {1, 2}, {1, 1}}},
+		}},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -146,6 +187,30 @@ func TestDay4_WordSearch_FindWord(t *testing.T) {
 	}
 }
 
+func TestDay4_WordSearch_FindWordRagged(t *testing.T) {
+	tests := []struct {
+		name     string
+		word     *Word
+		grid     Grid
+		expected *[]Match
+	}{
+		{"match across ragged rows", NewWord("XMAS"), raggedTestGrid, &[]Match{
+			{DirectionEast, Coordinate{0, 0}, []Coordinate{{0, 0}, {0, 1}, {0, 2}, {0, 3}}},
+			{DirectionSouth, Coordinate{0, 0}, []Coordinate{{0, 0}, {1, 0}, {2, 0}, {3, 0}}},
+		}},
+		{"match reversed word", NewWord("SAMX"), raggedTestGrid, &[]Match{
+			{DirectionWest, Coordinate{0, 3}, []Coordinate{{0, 3}, {0, 2}, {0, 1}, {0, 0}}},
+			{DirectionNorth, Coordinate{3, 0}, []Coordinate{{3, 0}, {2, 0}, {1, 0}, {0, 0}}},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wordSearch, _ := NewRaggedWordSearch(test.grid)
+			assert.Equal(t, test.expected, wordSearch.FindWord(test.word))
+		})
+	}
+}
+
 func TestDay4_createGrid(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -167,3 +232,475 @@ func TestDay4_createGrid(t *testing.T) {
 		})
 	}
 }
+
+func TestDay4_WordSearch_FindWords(t *testing.T) {
+	xmas := NewWord("XMAS")
+	samx := NewWord("SAMX")
+	xma := NewWord("XMA")
+	mam := NewWord("MAM")
+	xmasX := NewXWord("MAS")
+	tr := NewWord("TR")
+	tests := []struct {
+		name          string
+		grid          Grid
+		words         []*Word
+		expectedWords int
+	}{
+		{"single word", validTestGridPart1, []*Word{xmas}, 1},
+		{"reversed words", validTestGridPart1, []*Word{xmas, samx}, 2},
+		{"overlapping prefixes", validTestGridPart1, []*Word{xmas, xma}, 2},
+		{"palindrome", validTestGridPart1, []*Word{mam}, 1},
+		{"mixed patterns", validTestGridPart1, []*Word{xmas, xmasX, mam}, 3},
+		{"duplicate word", validTestGridPart1, []*Word{xmas, xmas}, 1},
+		{"no match", validTestGridPart1, []*Word{tr}, 1},
+		{"ragged grid", raggedTestGrid, []*Word{xmas, samx, xma}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wordSearch, _ := NewRaggedWordSearch(test.grid)
+			result := wordSearch.FindWords(test.words)
+			for _, w := range test.words {
+				assert.Equal(t, wordSearch.FindWord(w), result[w], w.word)
+			}
+			assert.Len(t, result, test.expectedWords)
+		})
+	}
+}
+
+func TestDay4_WordSearch_FindWordsCounts(t *testing.T) {
+	xmas := NewWord("XMAS")
+	xmasX := NewXWord("MAS")
+	mam := NewWord("MAM")
+	wordSearch, _ := NewWordSearch(validTestGridPart1)
+	result := wordSearch.FindWords([]*Word{xmas, xmasX, mam})
+	assert.Len(t, *result[xmas], 18)
+	assert.Len(t, *result[xmasX], 9)
+	// a palindrome is found once, in the first direction it reads in,
+	// rather than again backwards over the same cells
+	assert.Len(t, *result[mam], 6)
+	for _, m := range *result[mam] {
+		assert.Contains(t, []Direction{DirectionEast, DirectionSouthEast, DirectionSouth, DirectionSouthWest}, m.direction)
+	}
+}
+
+func TestDay4_Stencil_ParseStencil(t *testing.T) {
+	tests := []struct {
+		name        string
+		drawing     string
+		expected    Stencil
+		expectedErr error
+	}{
+		{"flat", "0123", Stencil{cells: []stencilCell{{Coordinate{0, 0}, 0}, {Coordinate{0, 1}, 1}, {Coordinate{0, 2}, 2}, {Coordinate{0, 3}, 3}}}, nil},
+		{"knight", "\n0.\n..\n.1\n", Stencil{cells: []stencilCell{{Coordinate{0, 0}, 0}, {Coordinate{2, 1}, 1}}}, nil},
+		{"letters past nine", "9ab", Stencil{cells: []stencilCell{{Coordinate{0, 0}, 9}, {Coordinate{0, 1}, 10}, {Coordinate{0, 2}, 11}}}, nil},
+		{"unknown mark", "0.\n.X", Stencil{}, ErrInvalidStencil},
+		{"empty", "..\n..", Stencil{}, ErrInvalidStencil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ParseStencil(test.drawing)
+			assert.Equal(t, test.expected, result)
+			assert.ErrorIs(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestDay4_Word_NewStencilWord(t *testing.T) {
+	flat, _ := ParseStencil("012")
+	knight, _ := ParseStencil("0.\n..\n.1")
+	tests := []struct {
+		name        string
+		word        string
+		stencil     Stencil
+		expected    *Word
+		expectedErr error
+	}{
+		{"flat", "MAS", flat, &Word{word: "MAS", letters: []string{"M", "A", "S"}, pattern: []Pattern{
+			{direction: DirectionEast, coordinates: []Coordinate{{0, 0}, {0, 1}, {0, 2}}},
+			{direction: DirectionSouth, coordinates: []Coordinate{{0, 0}, {1, 0}, {2, 0}}},
+			{direction: DirectionWest, coordinates: []Coordinate{{0, 2}, {0, 1}, {0, 0}}},
+			{direction: DirectionNorth, coordinates: []Coordinate{{2, 0}, {1, 0}, {0, 0}}},
+		}}, nil},
+		{"knight", "XM", knight, &Word{word: "XM", letters: []string{"X", "M"}, pattern: []Pattern{
+			{direction: DirectionEast, coordinates: []Coordinate{{0, 0}, {2, 1}}},
+			{direction: DirectionSouth, coordinates: []Coordinate{{0, 2}, {1, 0}}},
+			{direction: DirectionWest, coordinates: []Coordinate{{2, 1}, {0, 0}}},
+			{direction: DirectionNorth, coordinates: []Coordinate{{1, 0}, {0, 2}}},
+			{direction: DirectionEast, reflected: true, coordinates: []Coordinate{{0, 1}, {2, 0}}},
+			{direction: DirectionSouth, reflected: true, coordinates: []Coordinate{{1, 2}, {0, 0}}},
+			{direction: DirectionWest, reflected: true, coordinates: []Coordinate{{2, 0}, {0, 1}}},
+			{direction: DirectionNorth, reflected: true, coordinates: []Coordinate{{0, 0}, {1, 2}}},
+		}}, nil},
+		{"mark past end of word", "X", knight, &Word{}, ErrInvalidStencil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := NewStencilWord(test.word, test.stencil)
+			assert.Equal(t, test.expected, result)
+			assert.ErrorIs(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestDay4_WordSearch_FindStencilWord(t *testing.T) {
+	xmas, _ := ParseStencil("0.0\n.1.\n2.2")
+	plus, _ := ParseStencil(".0.\n012\n.2.")
+	ell, _ := ParseStencil("0.\n1.\n23")
+	tests := []struct {
+		name     string
+		word     string
+		stencil  Stencil
+		grid     Grid
+		expected int
+	}{
+		{"x-mas matches NewXWord", "MAS", xmas, validTestGridPart1, len(*mustFindWord(t, validTestGridPart1, NewXWord("MAS")))},
+		{"x-mas small", "MAS", xmas, validSmallTestGridPart2, 1},
+		{"plus", "MAS", plus, Grid{
+			{".", "M", "."},
+			{"M", "A", "S"},
+			{".", "S", "."},
+		}, 1},
+		{"ell in every orientation", "XMAS", ell, Grid{
+			{"X", ".", ".", "S", "A"},
+			{"M", ".", ".", ".", "M"},
+			{"A", "S", ".", ".", "X"},
+		}, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			word, err := NewStencilWord(test.word, test.stencil)
+			assert.NoError(t, err)
+			assert.Len(t, *mustFindWord(t, test.grid, word), test.expected)
+		})
+	}
+}
+
+func mustFindWord(t *testing.T, g Grid, w *Word) *[]Match {
+	t.Helper()
+	wordSearch, err := NewWordSearch(g)
+	assert.NoError(t, err)
+	return wordSearch.FindWord(w)
+}
+
+func TestDay4_Match_CellsXWord(t *testing.T) {
+	matches := mustFindWord(t, validSmallTestGridPart2, NewXWord("MAS"))
+	assert.Equal(t, &[]Match{
+		{DirectionEast, Coordinate{0, 0}, []Coordinate{{0, 0}, {1, 1}, {2, 2}, {2, 0}, {0, 2}}},
+	}, matches)
+}
+
+func TestDay4_Grid_Render(t *testing.T) {
+	grid := Grid{
+		{"X", "M", "A", "S"},
+		{"M", "A", "T", "."},
+		{"Q", "Q", "Q", "Q"},
+	}
+	xmas := NewWord("XMAS")
+	mat := NewWord("MAT")
+	tests := []struct {
+		name     string
+		words    []*Word
+		only     *Word
+		style    HighlightStyle
+		expected string
+	}{
+		{"all words", []*Word{xmas, mat}, nil, HighlightCase, "XMAS\nMAT.\n....\n"},
+		{"single word", []*Word{xmas, mat}, mat, HighlightCase, "....\nMAT.\n....\n"},
+		{"word not searched", []*Word{xmas}, mat, HighlightCase, "....\n....\n....\n"},
+		{"ansi", []*Word{mat}, nil, HighlightANSI, "....\n" + ansiHighlight + "M" + ansiReset + ansiHighlight + "A" + ansiReset + ansiHighlight + "T" + ansiReset + ".\n....\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wordSearch, _ := NewWordSearch(grid)
+			results := wordSearch.FindWords(test.words)
+			out := &strings.Builder{}
+			var err error
+			if test.only != nil {
+				err = wordSearch.RenderWord(out, results, test.only, test.style)
+			} else {
+				err = wordSearch.Render(out, results, test.style)
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
+
+func TestDay4_Grid_RenderLowerCase(t *testing.T) {
+	grid := Grid{{"x", "m", "a", "s"}, {"a", "b", "c"}}
+	wordSearch, _ := NewRaggedWordSearch(grid)
+	out := &strings.Builder{}
+	assert.NoError(t, wordSearch.grid.Render(out, *wordSearch.FindWord(NewWord("xmas")), HighlightCase))
+	assert.Equal(t, "XMAS\n...\n", out.String())
+}
+
+func TestDay4_WordSearch_NewToroidalWordsearch(t *testing.T) {
+	tests := []struct {
+		name        string
+		grid        [][]string
+		expected    *WordSearch
+		expectedErr error
+	}{
+		{"rectangular_grid", rectangularTestGrid, &WordSearch{grid: rectangularTestGrid, wrap: true}, nil},
+		{"ragged_grid", raggedTestGrid, &WordSearch{}, ErrInvalidGrid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := NewToroidalWordSearch(test.grid)
+			assert.Equal(t, test.expected, result)
+			assert.ErrorIs(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestDay4_Grid_IsPatternAtWrapped(t *testing.T) {
+	grid := Grid{{"A", "S", "X", "M"}}
+	east := Pattern{direction: DirectionEast, coordinates: []Coordinate{{0, 0}, {0, 1}, {0, 2}, {0, 3}}}
+	assert.False(t, grid.IsPatternAt("XMAS", east, Coordinate{0, 2}))
+	assert.True(t, grid.IsPatternAtWrapped("XMAS", east, Coordinate{0, 2}))
+}
+
+func TestDay4_WordSearch_FindWordToroidal(t *testing.T) {
+	tests := []struct {
+		name     string
+		word     *Word
+		grid     Grid
+		expected *[]Match
+	}{
+		{"wrap east on a single row", NewWord("XMAS"), Grid{{"A", "S", "X", "M"}}, &[]Match{
+			{DirectionEast, Coordinate{0, 2}, []Coordinate{{0, 2}, {0, 3}, {0, 0}, {0, 1}}},
+		}},
+		{"wrap north", NewWord("XMAS"), Grid{{"M", "."}, {"X", "."}, {"S", "."}, {"A", "."}}, &[]Match{
+			{DirectionNorth, Coordinate{1, 0}, []Coordinate{{1, 0}, {0, 0}, {3, 0}, {2, 0}}},
+		}},
+		{"wrap diagonal through corner", NewWord("XMAS"), Grid{
+			{"A", ".", ".", "."},
+			{".", "S", ".", "."},
+			{".", ".", "X", "."},
+			{".", ".", ".", "M"},
+		}, &[]Match{
+			{DirectionSouthEast, Coordinate{2, 2}, []Coordinate{{2, 2}, {3, 3}, {0, 0}, {1, 1}}},
+		}},
+		{"word wrapping onto itself is found once", NewWord("ABAB"), Grid{
+			{"A", "B", "A", "B"},
+			{"C", "C", "C", "C"},
+		}, &[]Match{
+			// reading west from the first cell reads the same cells backwards
+			{DirectionEast, Coordinate{0, 0}, []Coordinate{{0, 0}, {0, 1}, {0, 2}, {0, 3}}},
+		}},
+		{"word longer than the grid", NewWord("ABCAB"), Grid{{"A", "B", "C"}}, &[]Match{
+			{DirectionEast, Coordinate{0, 0}, []Coordinate{{0, 0}, {0, 1}, {0, 2}}},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wordSearch, _ := NewToroidalWordSearch(test.grid)
+			assert.Equal(t, test.expected, wordSearch.FindWord(test.word))
+			assert.Equal(t, test.expected, wordSearch.FindWords([]*Word{test.word})[test.word])
+		})
+	}
+}
+
+func TestDay4_Generator_NewGenerator(t *testing.T) {
+	allDirections := []Direction{DirectionEast, DirectionSouth, DirectionSouthEast, DirectionWest, DirectionSouthWest, DirectionNorth, DirectionNorthEast, DirectionNorthWest}
+	tests := []struct {
+		name        string
+		words       []string
+		rows        int
+		columns     int
+		directions  []Direction
+		expectedErr error
+	}{
+		{"valid", []string{"XMAS", "SANTA"}, 5, 5, allDirections, nil},
+		{"no rows", []string{"XMAS"}, 0, 5, allDirections, ErrInvalidPuzzle},
+		{"no directions", []string{"XMAS"}, 5, 5, []Direction{}, ErrInvalidPuzzle},
+		{"no words", []string{}, 5, 5, allDirections, ErrInvalidPuzzle},
+		{"palindrome", []string{"XMAS", "LEVEL"}, 5, 5, allDirections, ErrInvalidPuzzle},
+		{"word inside another", []string{"XMAS", "MAS"}, 5, 5, allDirections, ErrInvalidPuzzle},
+		{"word inside another backwards", []string{"XMAS", "AMX"}, 5, 5, allDirections, ErrInvalidPuzzle},
+		{"duplicate word", []string{"XMAS", "XMAS"}, 5, 5, allDirections, ErrInvalidPuzzle},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewGenerator(test.words, test.rows, test.columns, test.directions, 1)
+			assert.ErrorIs(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestDay4_Generator_Generate(t *testing.T) {
+	tests := []struct {
+		name       string
+		words      []string
+		rows       int
+		columns    int
+		directions []Direction
+		seed       int64
+	}{
+		{"single word", []string{"XMAS"}, 4, 4, []Direction{DirectionEast}, 1},
+		{"several words", []string{"XMAS", "SANTA", "ELF", "SLEIGH"}, 8, 8, []Direction{DirectionEast, DirectionSouth, DirectionSouthEast}, 2},
+		{"rectangular", []string{"REINDEER", "SNOW"}, 3, 10, []Direction{DirectionEast, DirectionWest}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator, err := NewGenerator(test.words, test.rows, test.columns, test.directions, test.seed)
+			assert.NoError(t, err)
+			grid, err := generator.Generate()
+			assert.NoError(t, err)
+			assert.Len(t, grid, test.rows)
+			for _, row := range grid {
+				assert.Len(t, row, test.columns)
+			}
+
+			wordSearch, err := NewWordSearch(grid)
+			assert.NoError(t, err)
+			for _, w := range test.words {
+				matches := wordSearch.FindWord(NewWord(w))
+				assert.Len(t, *matches, 1, w)
+				for _, m := range *matches {
+					assert.Contains(t, test.directions, m.direction, w)
+				}
+			}
+		})
+	}
+}
+
+func TestDay4_Generator_GenerateIsSeeded(t *testing.T) {
+	words := []string{"XMAS", "SANTA", "ELF"}
+	directions := []Direction{DirectionEast, DirectionSouth}
+	first, _ := NewGenerator(words, 6, 6, directions, 42)
+	second, _ := NewGenerator(words, 6, 6, directions, 42)
+	firstGrid, err := first.Generate()
+	assert.NoError(t, err)
+	secondGrid, err := second.Generate()
+	assert.NoError(t, err)
+	assert.Equal(t, firstGrid, secondGrid)
+}
+
+func TestDay4_Generator_GenerateTooSmall(t *testing.T) {
+	generator, _ := NewGenerator([]string{"XMAS"}, 3, 3, []Direction{DirectionEast}, 1)
+	_, err := generator.Generate()
+	assert.ErrorIs(t, err, ErrPuzzleNotFound)
+}
+
+func TestDay4_Generator_GenerateInfeasible(t *testing.T) {
+	// only one eight letter word fits across each of the ten rows, so eleven can never fit,
+	// but there are far too many ways of trying to place ten of them to try them all
+	words := []string{}
+	for i := 0; i < 11; i++ {
+		words = append(words, fmt.Sprintf("%cBCDEFGH", 'I'+i))
+	}
+	generator, err := NewGenerator(words, 10, 8, []Direction{DirectionEast}, 1)
+	assert.NoError(t, err)
+
+	_, err = generator.Generate()
+	assert.ErrorIs(t, err, ErrPuzzleNotFound)
+	assert.ErrorContains(t, err, "gave up")
+}
+
+func TestDay4_splitLetters(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"ascii", "XMAS", []string{"X", "M", "A", "S"}},
+		{"precomposed accents", "NOËL", []string{"N", "O", "Ë", "L"}},
+		{"combining accents", "NOE\u0308L", []string{"N", "O", "E\u0308", "L"}},
+		{"cyrillic", "ЁЛКА", []string{"Ё", "Л", "К", "А"}},
+		{"cjk", "圣诞节", []string{"圣", "诞", "节"}},
+		{"joined emoji", "a👩\u200d👩\u200d👧b", []string{"a", "👩\u200d👩\u200d👧", "b"}},
+		{"emoji modifier", "👋🏽!", []string{"👋🏽", "!"}},
+		{"empty", "", []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, splitLetters(test.input))
+		})
+	}
+}
+
+func TestDay4_MatchMode_fold(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     MatchMode
+		letter   string
+		expected string
+	}{
+		{"exact", MatchExact, "É", "É"},
+		{"ignore case", MatchIgnoreCase, "É", "é"},
+		{"ignore accents", MatchIgnoreAccents, "É", "E"},
+		{"ignore combining accents", MatchIgnoreAccents, "E\u0301", "E"},
+		{"ignore both", MatchIgnoreCase | MatchIgnoreAccents, "É", "e"},
+		{"cyrillic", MatchIgnoreCase | MatchIgnoreAccents, "Ё", "е"},
+		{"comma below", MatchIgnoreAccents, "ș", "s"},
+		{"stacked accents", MatchIgnoreAccents, "ế", "e"},
+		{"greek", MatchIgnoreAccents, "ά", "α"},
+		{"stroke", MatchIgnoreCase | MatchIgnoreAccents, "Ł", "l"},
+		{"exact keeps combining accents", MatchExact, "E\u0301", "E\u0301"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.mode.fold(test.letter))
+		})
+	}
+}
+
+func TestDay4_MatchMode_fold_Encodings(t *testing.T) {
+	// precomposed letters and the same letters written with combining accents fold the same way
+	tests := []struct {
+		name        string
+		precomposed string
+		combining   string
+	}{
+		{"acute", "É", "E\u0301"},
+		{"comma below", "ș", "s\u0326"},
+		{"cedilla", "ţ", "t\u0327"},
+		{"caron", "ǎ", "a\u030C"},
+		{"horn", "ơ", "o\u031B"},
+		{"circumflex and acute", "ế", "e\u0302\u0301"},
+		{"greek tonos", "ά", "α\u0301"},
+		{"cyrillic breve", "Й", "И\u0306"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, mode := range []MatchMode{MatchIgnoreAccents, MatchIgnoreCase | MatchIgnoreAccents} {
+				assert.Equal(t, mode.fold(test.precomposed), mode.fold(test.combining))
+			}
+		})
+	}
+}
+
+func TestDay4_WordSearch_FindWordUnicode(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		word     string
+		mode     MatchMode
+		expected int
+	}{
+		{"accented word", "NOËL\n....", "NOËL", MatchExact, 1},
+		{"cyrillic word", "ЁЛКА\n....", "АКЛЁ", MatchExact, 1},
+		{"cjk word", "圣..\n诞..\n节..", "圣诞节", MatchExact, 1},
+		{"combining accent in grid", "NOE\u0308L\n....", "NOE\u0308L", MatchExact, 1},
+		{"case differs", "noël\n....", "NOËL", MatchExact, 0},
+		{"ignore case", "noël\n....", "NOËL", MatchIgnoreCase, 1},
+		{"accent differs", "NOEL\n....", "NOËL", MatchIgnoreCase, 0},
+		{"ignore accents", "NOEL\n....", "NOËL", MatchIgnoreAccents, 1},
+		{"ignore combining accents", "NOE\u0308L\n....", "NOËL", MatchIgnoreAccents, 1},
+		{"ignore case and accents", "noel\n....", "NOËL", MatchIgnoreCase | MatchIgnoreAccents, 1},
+		{"cyrillic ignore case and accents", "елка\n....", "ЁЛКА", MatchIgnoreCase | MatchIgnoreAccents, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grid, err := createGrid(strings.NewReader(test.input))
+			assert.NoError(t, err)
+			wordSearch, err := NewRaggedWordSearch(grid)
+			assert.NoError(t, err)
+			wordSearch.SetMatchMode(test.mode)
+			word := NewWord(test.word)
+			assert.Len(t, *wordSearch.FindWord(word), test.expected)
+			assert.Len(t, *wordSearch.FindWords([]*Word{word})[word], test.expected)
+		})
+	}
+}
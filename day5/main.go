@@ -3,23 +3,53 @@ package main
 import (
 	"bufio"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 const (
 	REGEX_RULE   = `^(\d+)\|(\d+)$`
-	REGEX_MANUAL = `^(\d+(?:,(\d+))+)$`
+	REGEX_MANUAL = `^(\d+(?:,(\d+))*)$`
 )
 
 var (
 	ErrInputCannotBeZero     = errors.New("input cannot be zero")
 	ErrInputCannotBeNegative = errors.New("input cannot be negative")
+	ErrCyclicRules           = errors.New("cyclic rules")
+	ErrUnknownLine           = errors.New("unknown line")
+	ErrMissingSection        = errors.New("missing section")
+	ErrMissingSeparator      = errors.New("missing blank line between rules and manuals")
+	ErrDuplicatePage         = errors.New("duplicate page in manual")
+	ErrEvenManual            = errors.New("manual has an even number of pages so no single middle page")
 )
 
+// CyclicRulesError is returned when the rules for the pages of a manual
+// contradict each other, so no order of the pages can satisfy them all.
+type CyclicRulesError struct {
+	// Pages lists the pages of the cycle in rule order, starting and ending on the same page.
+	Pages []PageNumber
+}
+
+// Error describes the cycle of pages.
+func (e *CyclicRulesError) Error() string {
+	pages := make([]string, len(e.Pages))
+	for i, page := range e.Pages {
+		pages[i] = strconv.Itoa(page.Int())
+	}
+	return fmt.Sprintf("%s: pages %s", ErrCyclicRules, strings.Join(pages, " -> "))
+}
+
+// Unwrap allows the error to be matched against ErrCyclicRules.
+func (e *CyclicRulesError) Unwrap() error {
+	return ErrCyclicRules
+}
+
 // PageNumber is a ValueObject that represents a page number.
 type PageNumber struct {
 	number int
@@ -59,6 +89,57 @@ func NewPageOrderingRule(left, right PageNumber) PageOrderingRule {
 	}
 }
 
+// Left returns the page that must come first.
+func (r *PageOrderingRule) Left() PageNumber {
+	return r.left
+}
+
+// Right returns the page that must come after the left page.
+func (r *PageOrderingRule) Right() PageNumber {
+	return r.right
+}
+
+// Violation checks if a rule is broken by a SafetyManual and if so, explains how.
+func (r *PageOrderingRule) Violation(manual *SafetyManual) (RuleViolation, bool) {
+	valid, _ := r.Valid(manual)
+	if valid {
+		return RuleViolation{}, false
+	}
+	return RuleViolation{
+		rule:       *r,
+		leftIndex:  manual.PageIndex(r.left),
+		rightIndex: manual.PageIndex(r.right),
+	}, true
+}
+
+// RuleViolation is a ValueObject that explains how a PageOrderingRule is broken by a SafetyManual.
+type RuleViolation struct {
+	rule       PageOrderingRule
+	leftIndex  int
+	rightIndex int
+}
+
+// Rule returns the rule that was broken.
+func (v RuleViolation) Rule() PageOrderingRule {
+	return v.rule
+}
+
+// LeftIndex returns the index of the page that should have come first.
+func (v RuleViolation) LeftIndex() int {
+	return v.leftIndex
+}
+
+// RightIndex returns the index of the page that should have come after.
+func (v RuleViolation) RightIndex() int {
+	return v.rightIndex
+}
+
+// String describes the broken rule and where its pages are.
+func (v RuleViolation) String() string {
+	return fmt.Sprintf("rule %d|%d broken: page %d is at index %d but page %d is at index %d",
+		v.rule.left.Int(), v.rule.right.Int(), v.rule.left.Int(), v.leftIndex, v.rule.right.Int(), v.rightIndex)
+}
+
 // Correct changes the order of pages in the given manual based on the rule if possible.
 //
 // returns bool if the manual was corrected.
@@ -111,16 +192,317 @@ func (rs *PageOrderingRuleset) AddRule(rule PageOrderingRule) {
 
 // Correct corrects the order of pages in the given manual based on all rules in the ruleset.
 //
-// This is ugly, but it works.
-// It will keep running until no more corrections are made. To ensure no rule breaks another.
-// This should problably have a timeout and limit to ensure this doesnt break the program.
-func (rs *PageOrderingRuleset) Correct(manual *SafetyManual) {
-	running := true
-	for running {
-		running = false
-		for _, rule := range rs.rules {
-			if rule.Correct(manual) {
-				running = true
+// The rules that apply to the pages of the manual form a precedence graph, which is
+// sorted with Kahn's algorithm. When more than one page is free to go next, the page
+// that is earliest in the manual goes first, so a valid manual is left as it is.
+//
+// If the rules contradict each other a CyclicRulesError is returned, and if the manual repeats
+// a page ErrDuplicatePage is returned, and the manual is not changed.
+func (rs *PageOrderingRuleset) Correct(manual *SafetyManual) error {
+	graph, err := rs.precedenceGraph(manual.Pages())
+	if err != nil {
+		return err
+	}
+	order, err := graph.sort()
+	if err != nil {
+		return err
+	}
+
+	for i, page := range order {
+		manual.MovePage(page, i)
+	}
+	return nil
+}
+
+// CorrectMinimal corrects the order of pages in the given manual using as few page moves as possible.
+//
+// The pages that stay put must already be in an order the rules allow, so the most pages that
+// can stay put is the largest set of pages with no two in the wrong order. Pages in the wrong
+// order form a partial order, so by Dilworth's theorem that set is its largest antichain, found
+// from a maximum bipartite matching. Every other page is then moved once, to directly after the
+// page that should come before it.
+//
+// The moves are returned in the order they were applied, so they can be replayed on a copy of
+// the manual. If the rules contradict each other a CyclicRulesError is returned, and if the manual
+// repeats a page ErrDuplicatePage is returned, and the manual is not changed.
+func (rs *PageOrderingRuleset) CorrectMinimal(manual *SafetyManual) ([]PageMove, error) {
+	graph, err := rs.precedenceGraph(manual.Pages())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := graph.sort(); err != nil {
+		return nil, err
+	}
+
+	// pin the pages that stay put in their current order and sort around them
+	keep := graph.largestOrderedSubset()
+	for i := 1; i < len(keep); i++ {
+		graph.addEdge(keep[i-1], keep[i])
+	}
+	order, err := graph.sort()
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make(map[PageNumber]bool, len(keep))
+	for _, page := range keep {
+		kept[page] = true
+	}
+	moves := []PageMove{}
+	for i, page := range order {
+		if kept[page] {
+			continue
+		}
+		// move the page to directly after the page before it in the corrected order
+		index := 0
+		if i > 0 {
+			index = manual.PageIndex(order[i-1]) + 1
+			if manual.PageIndex(page) < index {
+				index--
+			}
+		}
+		if manual.PageIndex(page) == index {
+			continue
+		}
+		move := NewPageMove(page, index)
+		move.Apply(manual)
+		moves = append(moves, move)
+	}
+	return moves, nil
+}
+
+// PageMove is a ValueObject that represents moving a page of a manual to a new index.
+type PageMove struct {
+	page  PageNumber
+	index int
+}
+
+// NewPageMove creates a new PageMove.
+func NewPageMove(page PageNumber, index int) PageMove {
+	return PageMove{
+		page:  page,
+		index: index,
+	}
+}
+
+// Page returns the page that is moved.
+func (mv PageMove) Page() PageNumber {
+	return mv.page
+}
+
+// Index returns the index the page is moved to.
+func (mv PageMove) Index() int {
+	return mv.index
+}
+
+// Apply moves the page in the given manual.
+func (mv PageMove) Apply(manual *SafetyManual) {
+	manual.MovePage(mv.page, mv.index)
+}
+
+// precedenceGraph is the graph of rules that apply to a set of pages, with an edge
+// from each page to every page that must come after it.
+type precedenceGraph struct {
+	pages  []PageNumber
+	after  map[PageNumber][]PageNumber
+	before map[PageNumber][]PageNumber
+	edges  map[PageOrderingRule]bool
+}
+
+// precedenceGraph builds the precedence graph of the rules restricted to the given pages.
+//
+// A repeated page has nowhere to go that satisfies every rule, so ErrDuplicatePage is returned.
+func (rs *PageOrderingRuleset) precedenceGraph(pages []PageNumber) (*precedenceGraph, error) {
+	g := &precedenceGraph{
+		pages:  pages,
+		after:  make(map[PageNumber][]PageNumber),
+		before: make(map[PageNumber][]PageNumber),
+		edges:  make(map[PageOrderingRule]bool),
+	}
+	inPages := make(map[PageNumber]bool, len(pages))
+	for _, page := range pages {
+		if inPages[page] {
+			return nil, fmt.Errorf("%w: page %d", ErrDuplicatePage, page.Int())
+		}
+		inPages[page] = true
+	}
+	for _, rule := range rs.rules {
+		if inPages[rule.left] && inPages[rule.right] {
+			g.addEdge(rule.left, rule.right)
+		}
+	}
+	return g, nil
+}
+
+// addEdge adds an edge so the left page must come before the right page, unless it already exists.
+func (g *precedenceGraph) addEdge(left, right PageNumber) {
+	edge := NewPageOrderingRule(left, right)
+	if g.edges[edge] {
+		return
+	}
+	g.edges[edge] = true
+	g.after[left] = append(g.after[left], right)
+	g.before[right] = append(g.before[right], left)
+}
+
+// sort orders the pages with Kahn's algorithm. When more than one page is free to go next,
+// the page that is earliest in the graph's pages goes first.
+func (g *precedenceGraph) sort() ([]PageNumber, error) {
+	inDegree := make(map[PageNumber]int, len(g.pages))
+	for _, page := range g.pages {
+		inDegree[page] = len(g.before[page])
+	}
+
+	// repeatedly take the earliest page that has no pages left to go before it
+	order := make([]PageNumber, 0, len(g.pages))
+	placed := make(map[PageNumber]bool, len(g.pages))
+	for len(order) < len(g.pages) {
+		next, found := PageNumber{}, false
+		for _, page := range g.pages {
+			if !placed[page] && inDegree[page] == 0 {
+				next, found = page, true
+				break
+			}
+		}
+		if !found {
+			return nil, &CyclicRulesError{Pages: findCycle(g.pages, placed, g.before)}
+		}
+		placed[next] = true
+		order = append(order, next)
+		for _, page := range g.after[next] {
+			inDegree[page]--
+		}
+	}
+	return order, nil
+}
+
+// largestOrderedSubset returns the largest set of pages, in their current order, where no page
+// must come before a page that is currently ahead of it. The graph must not contain a cycle.
+func (g *precedenceGraph) largestOrderedSubset() []PageNumber {
+	n := len(g.pages)
+	position := make(map[PageNumber]int, n)
+	for i, page := range g.pages {
+		position[page] = i
+	}
+
+	// pages i and j are out of order if i is ahead of j but j must come before i
+	outOfOrder := make([][]int, n)
+	for j, page := range g.pages {
+		for _, p := range g.reachable(page) {
+			if i := position[p]; i < j {
+				outOfOrder[i] = append(outOfOrder[i], j)
+			}
+		}
+	}
+
+	// find a maximum matching of the out of order pairs with Kuhn's algorithm
+	matchLeft := make([]int, n)
+	matchRight := make([]int, n)
+	for i := range matchLeft {
+		matchLeft[i], matchRight[i] = -1, -1
+	}
+	var augment func(i int, visited []bool) bool
+	augment = func(i int, visited []bool) bool {
+		for _, j := range outOfOrder[i] {
+			if visited[j] {
+				continue
+			}
+			visited[j] = true
+			if matchRight[j] == -1 || augment(matchRight[j], visited) {
+				matchLeft[i], matchRight[j] = j, i
+				return true
+			}
+		}
+		return false
+	}
+	for i := 0; i < n; i++ {
+		augment(i, make([]bool, n))
+	}
+
+	// by König's theorem the pages reachable by alternating paths from unmatched
+	// left pages, that are not also reached on the right, form the largest antichain
+	reachedLeft := make([]bool, n)
+	reachedRight := make([]bool, n)
+	queue := []int{}
+	for i := 0; i < n; i++ {
+		if matchLeft[i] == -1 {
+			reachedLeft[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, j := range outOfOrder[i] {
+			if reachedRight[j] {
+				continue
+			}
+			reachedRight[j] = true
+			if k := matchRight[j]; k != -1 && !reachedLeft[k] {
+				reachedLeft[k] = true
+				queue = append(queue, k)
+			}
+		}
+	}
+
+	keep := []PageNumber{}
+	for i, page := range g.pages {
+		if reachedLeft[i] && !reachedRight[i] {
+			keep = append(keep, page)
+		}
+	}
+	return keep
+}
+
+// reachable returns every page that must come after the given page, directly or through other rules.
+func (g *precedenceGraph) reachable(page PageNumber) []PageNumber {
+	visited := map[PageNumber]bool{page: true}
+	stack := []PageNumber{page}
+	reached := []PageNumber{}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, next := range g.after[p] {
+			if !visited[next] {
+				visited[next] = true
+				reached = append(reached, next)
+				stack = append(stack, next)
+			}
+		}
+	}
+	return reached
+}
+
+// findCycle finds a cycle amongst the pages that could not be placed.
+//
+// Every unplaced page has at least one unplaced page that must go before it,
+// so following those pages backwards must eventually revisit a page.
+func findCycle(pages []PageNumber, placed map[PageNumber]bool, before map[PageNumber][]PageNumber) []PageNumber {
+	var page PageNumber
+	for _, p := range pages {
+		if !placed[p] {
+			page = p
+			break
+		}
+	}
+
+	path := []PageNumber{}
+	seenAt := make(map[PageNumber]int)
+	for {
+		if i, seen := seenAt[page]; seen {
+			cycle := append([]PageNumber{}, path[i:]...)
+			// reverse the path so the cycle reads in rule order
+			for l, r := 0, len(cycle)-1; l < r; l, r = l+1, r-1 {
+				cycle[l], cycle[r] = cycle[r], cycle[l]
+			}
+			return append(cycle, cycle[0])
+		}
+		seenAt[page] = len(path)
+		path = append(path, page)
+		for _, p := range before[page] {
+			if !placed[p] {
+				page = p
+				break
 			}
 		}
 	}
@@ -137,145 +519,485 @@ func (rs *PageOrderingRuleset) Valid(manual *SafetyManual) bool {
 	return true
 }
 
+// Violations returns every rule in the ruleset that is broken by a SafetyManual, in rule order.
+func (rs *PageOrderingRuleset) Violations(manual *SafetyManual) []RuleViolation {
+	violations := []RuleViolation{}
+	for _, rule := range rs.rules {
+		if violation, broken := rule.Violation(manual); broken {
+			violations = append(violations, violation)
+		}
+	}
+	return violations
+}
+
+// Restrict returns a new ruleset with only the rules that apply to the pages of a SafetyManual.
+func (rs *PageOrderingRuleset) Restrict(manual *SafetyManual) *PageOrderingRuleset {
+	restricted := NewPageOrderingRuleset()
+	for _, rule := range rs.rules {
+		if manual.PageIndex(rule.left) != -1 && manual.PageIndex(rule.right) != -1 {
+			restricted.AddRule(rule)
+		}
+	}
+	return restricted
+}
+
+// Analyse checks the ruleset for contradictory, redundant and duplicate rules.
+func (rs *PageOrderingRuleset) Analyse() RulesetAnalysis {
+	analysis := RulesetAnalysis{
+		cycles:         [][]PageNumber{},
+		contradictions: []PageOrderingRule{},
+		redundant:      []PageOrderingRule{},
+		duplicates:     []PageOrderingRule{},
+	}
+	graph := newRuleGraph(rs.rules)
+
+	// any rule seen before is a duplicate
+	seen := make(map[PageOrderingRule]bool, len(rs.rules))
+	for _, rule := range rs.rules {
+		if seen[rule] {
+			analysis.duplicates = append(analysis.duplicates, rule)
+		}
+		seen[rule] = true
+	}
+
+	// pages that can each be reached from the other form a cycle,
+	// and every rule between pages of the same cycle contradicts the others
+	component := make(map[PageNumber]int)
+	for i, pages := range graph.cycles() {
+		analysis.cycles = append(analysis.cycles, pages)
+		for _, page := range pages {
+			component[page] = i + 1
+		}
+	}
+	inCycle := func(rule PageOrderingRule) bool {
+		return component[rule.left] != 0 && component[rule.left] == component[rule.right]
+	}
+	for _, rule := range graph.rules {
+		if inCycle(rule) {
+			analysis.contradictions = append(analysis.contradictions, rule)
+		}
+	}
+
+	// a rule is redundant if its right page can be reached from its left page another way,
+	// apart from rules in a cycle where every page can reach every other, as they already contradict
+	for _, rule := range graph.rules {
+		if !inCycle(rule) && graph.reachableWithout(rule) {
+			analysis.redundant = append(analysis.redundant, rule)
+		}
+	}
+
+	return analysis
+}
+
+// WriteDOT writes the rules as a Graphviz DOT graph, with an edge from each left page to its right page.
+//
+// Contradictory rules are drawn in red and redundant rules are dashed.
+// To draw the rules for a single manual, Restrict the ruleset first.
+func (rs *PageOrderingRuleset) WriteDOT(out io.Writer) error {
+	analysis := rs.Analyse()
+	contradictory := make(map[PageOrderingRule]bool)
+	for _, rule := range analysis.contradictions {
+		contradictory[rule] = true
+	}
+	redundant := make(map[PageOrderingRule]bool)
+	for _, rule := range analysis.redundant {
+		redundant[rule] = true
+	}
+
+	graph := newRuleGraph(rs.rules)
+	lines := []string{"digraph rules {"}
+	for _, page := range graph.pages {
+		lines = append(lines, fmt.Sprintf("  %d;", page.Int()))
+	}
+	for _, rule := range graph.rules {
+		attributes := []string{}
+		if contradictory[rule] {
+			attributes = append(attributes, "color=red")
+		}
+		if redundant[rule] {
+			attributes = append(attributes, "style=dashed")
+		}
+		line := fmt.Sprintf("  %d -> %d", rule.left.Int(), rule.right.Int())
+		if len(attributes) > 0 {
+			line += " [" + strings.Join(attributes, ", ") + "]"
+		}
+		lines = append(lines, line+";")
+	}
+	lines = append(lines, "}")
+
+	_, err := fmt.Fprintln(out, strings.Join(lines, "\n"))
+	return err
+}
+
+// RulesetAnalysis is a ValueObject that describes the problems found in a PageOrderingRuleset.
+type RulesetAnalysis struct {
+	cycles         [][]PageNumber
+	contradictions []PageOrderingRule
+	redundant      []PageOrderingRule
+	duplicates     []PageOrderingRule
+}
+
+// Cycles returns each group of pages whose rules contradict each other, sorted by page number.
+func (a RulesetAnalysis) Cycles() [][]PageNumber {
+	return a.cycles
+}
+
+// Contradictions returns the rules that are part of a cycle.
+func (a RulesetAnalysis) Contradictions() []PageOrderingRule {
+	return a.contradictions
+}
+
+// Redundant returns the rules that are already implied by a chain of other rules.
+func (a RulesetAnalysis) Redundant() []PageOrderingRule {
+	return a.redundant
+}
+
+// Duplicates returns each repeat of a rule that is already in the ruleset.
+func (a RulesetAnalysis) Duplicates() []PageOrderingRule {
+	return a.duplicates
+}
+
+// Consistent checks if the ruleset has no contradictions.
+func (a RulesetAnalysis) Consistent() bool {
+	return len(a.cycles) == 0
+}
+
+// ruleGraph is the graph of pages with an edge for each distinct rule.
+type ruleGraph struct {
+	pages []PageNumber
+	rules []PageOrderingRule
+	after map[PageNumber][]PageNumber
+}
+
+// newRuleGraph creates a ruleGraph, keeping pages and rules in the order they first appear.
+func newRuleGraph(rules []PageOrderingRule) *ruleGraph {
+	g := &ruleGraph{after: make(map[PageNumber][]PageNumber)}
+	seenPage := make(map[PageNumber]bool)
+	seenRule := make(map[PageOrderingRule]bool)
+	for _, rule := range rules {
+		for _, page := range []PageNumber{rule.left, rule.right} {
+			if !seenPage[page] {
+				seenPage[page] = true
+				g.pages = append(g.pages, page)
+			}
+		}
+		if seenRule[rule] {
+			continue
+		}
+		seenRule[rule] = true
+		g.rules = append(g.rules, rule)
+		g.after[rule.left] = append(g.after[rule.left], rule.right)
+	}
+	return g
+}
+
+// cycles finds the strongly connected components of the graph with Tarjan's algorithm,
+// returning those that contain a cycle.
+func (g *ruleGraph) cycles() [][]PageNumber {
+	index := make(map[PageNumber]int)
+	lowLink := make(map[PageNumber]int)
+	onStack := make(map[PageNumber]bool)
+	stack := []PageNumber{}
+	components := [][]PageNumber{}
+	next := 0
+
+	var connect func(page PageNumber)
+	connect = func(page PageNumber) {
+		index[page] = next
+		lowLink[page] = next
+		next++
+		stack = append(stack, page)
+		onStack[page] = true
+
+		selfLoop := false
+		for _, p := range g.after[page] {
+			if p == page {
+				selfLoop = true
+			}
+			if _, visited := index[p]; !visited {
+				connect(p)
+				lowLink[page] = min(lowLink[page], lowLink[p])
+			} else if onStack[p] {
+				lowLink[page] = min(lowLink[page], index[p])
+			}
+		}
+
+		if lowLink[page] != index[page] {
+			return
+		}
+		component := []PageNumber{}
+		for {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[p] = false
+			component = append(component, p)
+			if p == page {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop {
+			sort.Slice(component, func(i, j int) bool {
+				return component[i].number < component[j].number
+			})
+			components = append(components, component)
+		}
+	}
+
+	for _, page := range g.pages {
+		if _, visited := index[page]; !visited {
+			connect(page)
+		}
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i][0].number < components[j][0].number
+	})
+	return components
+}
+
+// reachableWithout checks if the right page of a rule can be reached from its left page
+// without following the rule itself.
+func (g *ruleGraph) reachableWithout(rule PageOrderingRule) bool {
+	visited := map[PageNumber]bool{rule.left: true}
+	queue := []PageNumber{}
+	for _, p := range g.after[rule.left] {
+		if p != rule.right && !visited[p] {
+			visited[p] = true
+			queue = append(queue, p)
+		}
+	}
+	for len(queue) > 0 {
+		page := queue[0]
+		queue = queue[1:]
+		for _, p := range g.after[page] {
+			if p == rule.right {
+				return true
+			}
+			if !visited[p] {
+				visited[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+	return false
+}
+
 // SafetyManual is an Entity that represents a safety manual.
+//
+// The pages are kept in order in a slice, alongside an index of where each page is,
+// so looking up a page is constant time and moving one only touches the pages it passes.
 type SafetyManual struct {
-	indexedPages map[int]PageNumber
+	pages     []PageNumber
+	pageIndex map[PageNumber]int
 }
 
 // NewSafetyManual creates a new SafetyManual.
 func NewSafetyManual(pages []PageNumber) *SafetyManual {
 	// index pages and store them
-	indexedPages := make(map[int]PageNumber)
-	for i, page := range pages {
-		indexedPages[i] = page
+	m := &SafetyManual{
+		pages:     append([]PageNumber{}, pages...),
+		pageIndex: make(map[PageNumber]int, len(pages)),
 	}
-	return &SafetyManual{
-		indexedPages: indexedPages,
+	for i := len(pages) - 1; i >= 0; i-- {
+		// a repeated page is indexed at its first position
+		m.pageIndex[pages[i]] = i
 	}
+	return m
 }
 
 // PageIndex returns the index of a page in the manual.
 //
 // If the page is not found, it returns -1.
 func (m *SafetyManual) PageIndex(page PageNumber) int {
-	for i, p := range m.indexedPages {
-		if p == page {
-			return i
-		}
+	if i, ok := m.pageIndex[page]; ok {
+		return i
 	}
 	return -1
 }
 
+// Pages returns the pages of the manual in order.
+func (m *SafetyManual) Pages() []PageNumber {
+	return append([]PageNumber{}, m.pages...)
+}
+
 // MiddlePage returns the middle page of the manual.
 func (m *SafetyManual) MiddlePage() PageNumber {
-	// get the middle page
-	middleIndex := len(m.indexedPages) / 2
-	return m.indexedPages[middleIndex]
+	if len(m.pages) == 0 {
+		return PageNumber{}
+	}
+	return m.pages[len(m.pages)/2]
 }
 
 // MovePage moves a page to a new index in the manual, shuffling across the remaining pages.
+//
+// A page that is not in the manual is inserted at the index.
 func (m *SafetyManual) MovePage(page PageNumber, index int) {
-	// reorder the indexed pages and skip the page to move
-	tempIndexedPages := make(map[int]PageNumber, len(m.indexedPages))
-	var j int
-	for i := 0; i < len(m.indexedPages); i++ {
-		if m.indexedPages[i] == page {
-			continue
-		}
-		tempIndexedPages[j] = m.indexedPages[i]
-		j++
+	from, ok := m.pageIndex[page]
+	if !ok {
+		index = max(0, min(index, len(m.pages)))
+		m.pages = append(m.pages, PageNumber{})
+		copy(m.pages[index+1:], m.pages[index:])
+		m.pages[index] = page
+		m.reindex(index, len(m.pages)-1)
+		return
 	}
 
-	// create a new map to store the indexed pages
-	newIndexedPages := make(map[int]PageNumber, len(m.indexedPages))
-	for i := 0; i < len(tempIndexedPages)+1; i++ {
-		if i == index {
-			newIndexedPages[i] = page
-		}
-		if i > index {
-			newIndexedPages[i] = tempIndexedPages[i-1]
-		}
-		if i < index {
-			newIndexedPages[i] = tempIndexedPages[i]
-		}
+	index = max(0, min(index, len(m.pages)-1))
+	switch {
+	case from < index:
+		// shuffle the pages in between back by one
+		copy(m.pages[from:index], m.pages[from+1:index+1])
+		m.pages[index] = page
+		m.reindex(from, index)
+	case from > index:
+		// shuffle the pages in between forward by one
+		copy(m.pages[index+1:from+1], m.pages[index:from])
+		m.pages[index] = page
+		m.reindex(index, from)
 	}
-
-	// update the indexed pages
-	m.indexedPages = newIndexedPages
 }
 
-func main() {
-	inputFile, err := os.Open("input.txt")
-	if err != nil {
-		log.Fatal(err)
+// reindex updates the index of every page between the two indexes, inclusive.
+func (m *SafetyManual) reindex(from, to int) {
+	for i := from; i <= to; i++ {
+		m.pageIndex[m.pages[i]] = i
 	}
-	defer inputFile.Close()
-
-	rules := NewPageOrderingRuleset()
-	manuals := []*SafetyManual{}
+}
 
+// Parse reads the page ordering rules and safety manuals from the input.
+//
+// The input must be a section of rules, one per line such as "47|53", then a blank line,
+// then a section of manuals, one per line such as "75,47,61,53,29". Every problem found is
+// reported together, each with its line number, including lines that belong to neither
+// section, rules and manuals in the wrong section, manuals that repeat a page and manuals
+// with an even number of pages, as they have no single middle page.
+func Parse(input io.Reader) (*PageOrderingRuleset, []*SafetyManual, error) {
 	regexRule := regexp.MustCompile(REGEX_RULE)
 	regexManual := regexp.MustCompile(REGEX_MANUAL)
 
-	scanner := bufio.NewScanner(inputFile)
+	rules := NewPageOrderingRuleset()
+	manuals := []*SafetyManual{}
+	errs := []error{}
+	inManuals := false
+
+	scanner := bufio.NewScanner(input)
+	lineNumber := 0
 	for scanner.Scan() {
-		if regexRule.MatchString(scanner.Text()) {
-			// Rule found
-			// Extract values
-			values := regexRule.FindStringSubmatch(scanner.Text())
-			leftValue, err := strconv.Atoi(values[1])
-			if err != nil {
-				log.Fatal(err)
+		lineNumber++
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// the first blank line separates the sections, any others are ignored
+			inManuals = true
+		case regexRule.MatchString(line):
+			if inManuals {
+				errs = append(errs, fmt.Errorf("line %d: %w: rule %q found after the blank line", lineNumber, ErrUnknownLine, line))
+				continue
 			}
-			rightValue, err := strconv.Atoi(values[2])
+			rule, err := parseRule(regexRule.FindStringSubmatch(line))
 			if err != nil {
-				log.Fatal(err)
+				errs = append(errs, fmt.Errorf("line %d: %w", lineNumber, err))
+				continue
 			}
-
-			// Create the rule
-			left, err := NewPageNumber(leftValue)
-			if err != nil {
-				log.Fatal(err)
+			rules.AddRule(rule)
+		case regexManual.MatchString(line):
+			if !inManuals {
+				errs = append(errs, fmt.Errorf("line %d: %w: manual %q found before the blank line", lineNumber, ErrMissingSeparator, line))
+				inManuals = true
 			}
-			right, err := NewPageNumber(rightValue)
+			manual, err := parseManual(line)
 			if err != nil {
-				log.Fatal(err)
+				errs = append(errs, fmt.Errorf("line %d: %w", lineNumber, err))
+				continue
 			}
-			rule := NewPageOrderingRule(left, right)
-
-			// Add it to our ruleset
-			rules.AddRule(rule)
+			manuals = append(manuals, manual)
+		default:
+			errs = append(errs, fmt.Errorf("line %d: %w: %q", lineNumber, ErrUnknownLine, line))
 		}
-		if regexManual.MatchString(scanner.Text()) {
-			// Manual found
-			// Extract values
-			valuesRaw := regexManual.FindStringSubmatch(scanner.Text())
-			values := strings.Split(valuesRaw[0], ",")
-
-			pages := []PageNumber{}
-			for _, v := range values {
-				pageValue, err := strconv.Atoi(v)
-				if err != nil {
-					log.Fatal(err)
-				}
-				page, err := NewPageNumber(pageValue)
-				if err != nil {
-					log.Fatal(err)
-				}
-				pages = append(pages, page)
-			}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
 
-			// Create the manual
-			manual := NewSafetyManual(pages)
-			manuals = append(manuals, manual)
+	if len(rules.rules) == 0 {
+		errs = append(errs, fmt.Errorf("%w: no rules found", ErrMissingSection))
+	}
+	if len(manuals) == 0 {
+		errs = append(errs, fmt.Errorf("%w: no manuals found", ErrMissingSection))
+	}
+	if len(errs) > 0 {
+		return NewPageOrderingRuleset(), []*SafetyManual{}, errors.Join(errs...)
+	}
+	return rules, manuals, nil
+}
+
+// parseRule creates a PageOrderingRule from the pages matched by REGEX_RULE.
+func parseRule(values []string) (PageOrderingRule, error) {
+	leftValue, err := strconv.Atoi(values[1])
+	if err != nil {
+		return PageOrderingRule{}, err
+	}
+	rightValue, err := strconv.Atoi(values[2])
+	if err != nil {
+		return PageOrderingRule{}, err
+	}
+
+	left, err := NewPageNumber(leftValue)
+	if err != nil {
+		return PageOrderingRule{}, err
+	}
+	right, err := NewPageNumber(rightValue)
+	if err != nil {
+		return PageOrderingRule{}, err
+	}
+	return NewPageOrderingRule(left, right), nil
+}
+
+// parseManual creates a SafetyManual from a line matched by REGEX_MANUAL.
+func parseManual(line string) (*SafetyManual, error) {
+	pages := []PageNumber{}
+	seen := make(map[PageNumber]bool)
+	for _, v := range strings.Split(line, ",") {
+		pageValue, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		page, err := NewPageNumber(pageValue)
+		if err != nil {
+			return nil, err
 		}
+		if seen[page] {
+			return nil, fmt.Errorf("%w: page %d", ErrDuplicatePage, page.Int())
+		}
+		seen[page] = true
+		pages = append(pages, page)
+	}
+	if len(pages)%2 == 0 {
+		return nil, fmt.Errorf("%w: %d pages", ErrEvenManual, len(pages))
 	}
+	return NewSafetyManual(pages), nil
+}
+
+func main() {
+	inputFile, err := os.Open("input.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer inputFile.Close()
+
+	rules, manuals, err := Parse(inputFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Sanity check the rules before using them
+	analysis := rules.Analyse()
+	log.Println("Rules contain", len(analysis.Cycles()), "cycles,", len(analysis.Redundant()), "redundant rules and", len(analysis.Duplicates()), "duplicates")
 
 	// Check if the rules are valid for each manual
 	// and sum the middle pages for part1 answer
 	var sumPart1 int
 	badManuals := []*SafetyManual{}
-	for _, manual := range manuals {
+	for i, manual := range manuals {
 		if rules.Valid(manual) {
 			// get the middle page of the manual
 			middlePage := manual.MiddlePage()
@@ -283,6 +1005,13 @@ func main() {
 		} else {
 			// All manuals that are not in the correct order
 			badManuals = append(badManuals, manual)
+
+			// Explain which rules the manual breaks
+			violations := rules.Violations(manual)
+			log.Println("Manual", i, "breaks", len(violations), "rules:")
+			for _, violation := range violations {
+				log.Println("  ", violation)
+			}
 		}
 	}
 
@@ -290,10 +1019,15 @@ func main() {
 	log.Println("(PART 1) Sum of middle pages:", sumPart1)
 
 	// Part2
-	var sumPart2 int
-	// Correct the order of the bad manuals
+	var sumPart2, moves int
+	// Correct the order of the bad manuals, moving as few pages as possible
 	for _, manual := range badManuals {
-		rules.Correct(manual)
+		applied, err := rules.CorrectMinimal(manual)
+		if err != nil {
+			log.Println("Skipping manual:", err)
+			continue
+		}
+		moves += len(applied)
 		// get the middle page of the manual of any valid
 		if rules.Valid(manual) {
 			middlePage := manual.MiddlePage()
@@ -302,5 +1036,5 @@ func main() {
 	}
 
 	// Print part 2 result
-	log.Println("(PART 2) Sum of middle pages:", sumPart2)
+	log.Println("(PART 2) Sum of middle pages:", sumPart2, "after", moves, "page moves")
 }
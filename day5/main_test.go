@@ -1,6 +1,8 @@
 package main
 
 import (
+	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -148,6 +150,7 @@ func TestDay5_SafetyManual_GetMiddlePage(t *testing.T) {
 		expected PageNumber
 	}{
 		{"odd number of pages", NewSafetyManual([]PageNumber{{75}, {47}, {61}, {53}, {29}}), PageNumber{61}},
+		{"no pages", NewSafetyManual([]PageNumber{}), PageNumber{}},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -172,6 +175,41 @@ func TestDay5_SafetyManual_MovePage(t *testing.T) {
 			index:    1,
 			expected: NewSafetyManual([]PageNumber{{75}, {61}, {47}, {53}, {29}}),
 		},
+		{
+			name:     "move page later",
+			manual:   NewSafetyManual([]PageNumber{{75}, {47}, {61}, {53}, {29}}),
+			page:     PageNumber{47},
+			index:    3,
+			expected: NewSafetyManual([]PageNumber{{75}, {61}, {53}, {47}, {29}}),
+		},
+		{
+			name:     "move page to start",
+			manual:   NewSafetyManual([]PageNumber{{75}, {47}, {61}, {53}, {29}}),
+			page:     PageNumber{29},
+			index:    0,
+			expected: NewSafetyManual([]PageNumber{{29}, {75}, {47}, {61}, {53}}),
+		},
+		{
+			name:     "move page past the end",
+			manual:   NewSafetyManual([]PageNumber{{75}, {47}, {61}, {53}, {29}}),
+			page:     PageNumber{75},
+			index:    9,
+			expected: NewSafetyManual([]PageNumber{{47}, {61}, {53}, {29}, {75}}),
+		},
+		{
+			name:     "move page to where it is",
+			manual:   NewSafetyManual([]PageNumber{{75}, {47}, {61}, {53}, {29}}),
+			page:     PageNumber{61},
+			index:    2,
+			expected: NewSafetyManual([]PageNumber{{75}, {47}, {61}, {53}, {29}}),
+		},
+		{
+			name:     "move page not in manual",
+			manual:   NewSafetyManual([]PageNumber{{75}, {47}, {61}}),
+			page:     PageNumber{13},
+			index:    1,
+			expected: NewSafetyManual([]PageNumber{{75}, {13}, {47}, {61}}),
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -301,3 +339,618 @@ func TestDay5_PageOrderingRuleset_Correct(t *testing.T) {
 		})
 	}
 }
+
+func TestDay5_PageOrderingRuleset_CorrectCyclic(t *testing.T) {
+	tests := []struct {
+		name          string
+		ruleset       *PageOrderingRuleset
+		manual        *SafetyManual
+		expectedPages []PageNumber
+	}{
+		{
+			name: "two page cycle",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{2}},
+					{PageNumber{2}, PageNumber{1}},
+				}},
+			manual:        NewSafetyManual([]PageNumber{{2}, {1}, {3}}),
+			expectedPages: []PageNumber{{1}, {2}, {1}},
+		},
+		{
+			name: "three page cycle after valid pages",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{9}, PageNumber{1}},
+					{PageNumber{1}, PageNumber{2}},
+					{PageNumber{2}, PageNumber{3}},
+					{PageNumber{3}, PageNumber{1}},
+					{PageNumber{3}, PageNumber{4}},
+				}},
+			manual:        NewSafetyManual([]PageNumber{{4}, {3}, {2}, {1}, {9}}),
+			expectedPages: []PageNumber{{1}, {2}, {3}, {1}},
+		},
+		{
+			name: "page must come before itself",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{5}, PageNumber{5}},
+				}},
+			manual:        NewSafetyManual([]PageNumber{{5}, {6}}),
+			expectedPages: []PageNumber{{5}, {5}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := test.manual.Pages()
+			err := test.ruleset.Correct(test.manual)
+			assert.ErrorIs(t, err, ErrCyclicRules)
+			var cyclicErr *CyclicRulesError
+			if assert.ErrorAs(t, err, &cyclicErr) {
+				assert.Equal(t, test.expectedPages, cyclicErr.Pages)
+			}
+			assert.Equal(t, original, test.manual.Pages())
+		})
+	}
+}
+
+func TestDay5_PageOrderingRuleset_CorrectDuplicatePage(t *testing.T) {
+	tests := []struct {
+		name    string
+		ruleset *PageOrderingRuleset
+	}{
+		{
+			name:    "no rules",
+			ruleset: &PageOrderingRuleset{},
+		},
+		{
+			name: "rules for the repeated page",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{2}},
+					{PageNumber{2}, PageNumber{3}},
+				}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manual := NewSafetyManual([]PageNumber{{2}, {1}, {2}, {3}})
+			original := manual.Pages()
+
+			// a repeated page is not a cycle in the rules
+			err := test.ruleset.Correct(manual)
+			assert.ErrorIs(t, err, ErrDuplicatePage)
+			assert.NotErrorIs(t, err, ErrCyclicRules)
+			assert.Equal(t, original, manual.Pages())
+
+			moves, err := test.ruleset.CorrectMinimal(manual)
+			assert.ErrorIs(t, err, ErrDuplicatePage)
+			assert.Nil(t, moves)
+			assert.Equal(t, original, manual.Pages())
+		})
+	}
+}
+
+func TestDay5_PageOrderingRuleset_CorrectIgnoresRulesForOtherPages(t *testing.T) {
+	ruleset := &PageOrderingRuleset{
+		rules: []PageOrderingRule{
+			{PageNumber{1}, PageNumber{2}},
+			{PageNumber{2}, PageNumber{1}},
+			{PageNumber{4}, PageNumber{3}},
+			{PageNumber{4}, PageNumber{3}},
+		}}
+	manual := NewSafetyManual([]PageNumber{{3}, {4}, {1}})
+	assert.NoError(t, ruleset.Correct(manual))
+	assert.Equal(t, NewSafetyManual([]PageNumber{{4}, {3}, {1}}), manual)
+}
+
+func TestDay5_CyclicRulesError_Error(t *testing.T) {
+	err := &CyclicRulesError{Pages: []PageNumber{{1}, {2}, {1}}}
+	assert.Equal(t, "cyclic rules: pages 1 -> 2 -> 1", err.Error())
+}
+
+func TestDay5_SafetyManual_Pages(t *testing.T) {
+	pages := []PageNumber{{75}, {47}, {61}, {53}, {29}}
+	assert.Equal(t, pages, NewSafetyManual(pages).Pages())
+}
+
+func TestDay5_SafetyManual_MovePageKeepsIndex(t *testing.T) {
+	manual := NewSafetyManual([]PageNumber{{75}, {47}, {61}, {53}, {29}})
+	manual.MovePage(PageNumber{29}, 1)
+	manual.MovePage(PageNumber{75}, 3)
+	for i, page := range manual.Pages() {
+		assert.Equal(t, i, manual.PageIndex(page))
+	}
+	assert.Equal(t, []PageNumber{{29}, {47}, {61}, {75}, {53}}, manual.Pages())
+}
+
+func TestDay5_PageOrderingRuleset_Violations(t *testing.T) {
+	tests := []struct {
+		name     string
+		ruleset  *PageOrderingRuleset
+		manual   *SafetyManual
+		expected []RuleViolation
+	}{
+		{
+			name: "manual is valid",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{47}, PageNumber{53}},
+					{PageNumber{97}, PageNumber{75}},
+				}},
+			manual:   NewSafetyManual([]PageNumber{{75}, {47}, {61}, {53}, {29}}),
+			expected: []RuleViolation{},
+		},
+		{
+			name: "manual breaks one rule",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{47}, PageNumber{53}},
+					{PageNumber{97}, PageNumber{75}},
+				}},
+			manual: NewSafetyManual([]PageNumber{{75}, {97}, {47}, {61}, {53}}),
+			expected: []RuleViolation{
+				{rule: PageOrderingRule{PageNumber{97}, PageNumber{75}}, leftIndex: 1, rightIndex: 0},
+			},
+		},
+		{
+			name: "manual breaks several rules",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{97}, PageNumber{13}},
+					{PageNumber{97}, PageNumber{47}},
+					{PageNumber{75}, PageNumber{29}},
+					{PageNumber{29}, PageNumber{13}},
+					{PageNumber{47}, PageNumber{13}},
+				}},
+			manual: NewSafetyManual([]PageNumber{{97}, {13}, {75}, {29}, {47}}),
+			expected: []RuleViolation{
+				{rule: PageOrderingRule{PageNumber{29}, PageNumber{13}}, leftIndex: 3, rightIndex: 1},
+				{rule: PageOrderingRule{PageNumber{47}, PageNumber{13}}, leftIndex: 4, rightIndex: 1},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.ruleset.Violations(test.manual))
+		})
+	}
+}
+
+func TestDay5_RuleViolation_String(t *testing.T) {
+	rule := NewPageOrderingRule(PageNumber{97}, PageNumber{75})
+	violation, broken := rule.Violation(NewSafetyManual([]PageNumber{{75}, {97}}))
+	assert.True(t, broken)
+	brokenRule := violation.Rule()
+	assert.Equal(t, PageNumber{97}, brokenRule.Left())
+	assert.Equal(t, PageNumber{75}, brokenRule.Right())
+	assert.Equal(t, 1, violation.LeftIndex())
+	assert.Equal(t, 0, violation.RightIndex())
+	assert.Equal(t, "rule 97|75 broken: page 97 is at index 1 but page 75 is at index 0", violation.String())
+}
+
+func TestDay5_PageOrderingRuleset_Restrict(t *testing.T) {
+	ruleset := &PageOrderingRuleset{
+		rules: []PageOrderingRule{
+			{PageNumber{1}, PageNumber{2}},
+			{PageNumber{2}, PageNumber{3}},
+			{PageNumber{3}, PageNumber{4}},
+		}}
+	manual := NewSafetyManual([]PageNumber{{3}, {2}, {1}})
+	expected := &PageOrderingRuleset{
+		rules: []PageOrderingRule{
+			{PageNumber{1}, PageNumber{2}},
+			{PageNumber{2}, PageNumber{3}},
+		}}
+	assert.Equal(t, expected, ruleset.Restrict(manual))
+}
+
+func TestDay5_PageOrderingRuleset_Analyse(t *testing.T) {
+	tests := []struct {
+		name     string
+		ruleset  *PageOrderingRuleset
+		expected RulesetAnalysis
+	}{
+		{
+			name: "consistent rules",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{2}},
+					{PageNumber{2}, PageNumber{3}},
+				}},
+			expected: RulesetAnalysis{
+				cycles:         [][]PageNumber{},
+				contradictions: []PageOrderingRule{},
+				redundant:      []PageOrderingRule{},
+				duplicates:     []PageOrderingRule{},
+			},
+		},
+		{
+			name: "duplicate and redundant rules",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{2}},
+					{PageNumber{2}, PageNumber{3}},
+					{PageNumber{1}, PageNumber{3}},
+					{PageNumber{3}, PageNumber{4}},
+					{PageNumber{1}, PageNumber{2}},
+					{PageNumber{2}, PageNumber{4}},
+				}},
+			expected: RulesetAnalysis{
+				cycles:         [][]PageNumber{},
+				contradictions: []PageOrderingRule{},
+				redundant: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{3}},
+					{PageNumber{2}, PageNumber{4}},
+				},
+				duplicates: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{2}},
+				},
+			},
+		},
+		{
+			name: "contradictory rules",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{5}, PageNumber{1}},
+					{PageNumber{1}, PageNumber{2}},
+					{PageNumber{2}, PageNumber{3}},
+					{PageNumber{3}, PageNumber{1}},
+					{PageNumber{7}, PageNumber{7}},
+				}},
+			expected: RulesetAnalysis{
+				cycles: [][]PageNumber{
+					{{1}, {2}, {3}},
+					{{7}},
+				},
+				contradictions: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{2}},
+					{PageNumber{2}, PageNumber{3}},
+					{PageNumber{3}, PageNumber{1}},
+					{PageNumber{7}, PageNumber{7}},
+				},
+				redundant:  []PageOrderingRule{},
+				duplicates: []PageOrderingRule{},
+			},
+		},
+		{
+			name: "redundant rule alongside a cycle",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{2}},
+					{PageNumber{2}, PageNumber{3}},
+					{PageNumber{1}, PageNumber{3}},
+					{PageNumber{4}, PageNumber{5}},
+					{PageNumber{5}, PageNumber{6}},
+					{PageNumber{6}, PageNumber{4}},
+					{PageNumber{4}, PageNumber{6}},
+					{PageNumber{3}, PageNumber{4}},
+				}},
+			expected: RulesetAnalysis{
+				cycles: [][]PageNumber{
+					{{4}, {5}, {6}},
+				},
+				contradictions: []PageOrderingRule{
+					{PageNumber{4}, PageNumber{5}},
+					{PageNumber{5}, PageNumber{6}},
+					{PageNumber{6}, PageNumber{4}},
+					{PageNumber{4}, PageNumber{6}},
+				},
+				// 4|6 can also be reached through 5, but only by a cycle
+				redundant: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{3}},
+				},
+				duplicates: []PageOrderingRule{},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := test.ruleset.Analyse()
+			assert.Equal(t, test.expected, result)
+			assert.Equal(t, len(test.expected.cycles) == 0, result.Consistent())
+		})
+	}
+}
+
+func TestDay5_PageOrderingRuleset_WriteDOT(t *testing.T) {
+	ruleset := &PageOrderingRuleset{
+		rules: []PageOrderingRule{
+			{PageNumber{1}, PageNumber{2}},
+			{PageNumber{2}, PageNumber{3}},
+			{PageNumber{1}, PageNumber{3}},
+			{PageNumber{3}, PageNumber{4}},
+			{PageNumber{4}, PageNumber{3}},
+		}}
+	tests := []struct {
+		name     string
+		ruleset  *PageOrderingRuleset
+		expected string
+	}{
+		{
+			name:    "all rules",
+			ruleset: ruleset,
+			expected: "digraph rules {\n" +
+				"  1;\n  2;\n  3;\n  4;\n" +
+				"  1 -> 2;\n" +
+				"  2 -> 3;\n" +
+				"  1 -> 3 [style=dashed];\n" +
+				"  3 -> 4 [color=red];\n" +
+				"  4 -> 3 [color=red];\n" +
+				"}\n",
+		},
+		{
+			name:    "rules for one manual",
+			ruleset: ruleset.Restrict(NewSafetyManual([]PageNumber{{3}, {1}, {2}})),
+			expected: "digraph rules {\n" +
+				"  1;\n  2;\n  3;\n" +
+				"  1 -> 2;\n" +
+				"  2 -> 3;\n" +
+				"  1 -> 3 [style=dashed];\n" +
+				"}\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &strings.Builder{}
+			assert.NoError(t, test.ruleset.WriteDOT(out))
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
+
+func TestDay5_PageOrderingRuleset_CorrectMinimal(t *testing.T) {
+	tests := []struct {
+		name          string
+		ruleset       *PageOrderingRuleset
+		manual        *SafetyManual
+		expected      *SafetyManual
+		expectedMoves []PageMove
+	}{
+		{
+			name: "manual is valid",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{47}, PageNumber{53}},
+					{PageNumber{97}, PageNumber{75}},
+				}},
+			manual:        NewSafetyManual([]PageNumber{{75}, {47}, {61}, {53}, {29}}),
+			expected:      NewSafetyManual([]PageNumber{{75}, {47}, {61}, {53}, {29}}),
+			expectedMoves: []PageMove{},
+		},
+		{
+			name: "one page out of place",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{2}},
+					{PageNumber{2}, PageNumber{3}},
+					{PageNumber{3}, PageNumber{4}},
+					{PageNumber{4}, PageNumber{5}},
+				}},
+			manual:        NewSafetyManual([]PageNumber{{2}, {3}, {4}, {5}, {1}}),
+			expected:      NewSafetyManual([]PageNumber{{1}, {2}, {3}, {4}, {5}}),
+			expectedMoves: []PageMove{{PageNumber{1}, 0}},
+		},
+		{
+			name: "keeps the longest ordered run",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{2}},
+					{PageNumber{2}, PageNumber{3}},
+					{PageNumber{3}, PageNumber{4}},
+					{PageNumber{4}, PageNumber{5}},
+				}},
+			manual:        NewSafetyManual([]PageNumber{{5}, {2}, {4}, {3}, {1}}),
+			expected:      NewSafetyManual([]PageNumber{{1}, {2}, {3}, {4}, {5}}),
+			expectedMoves: []PageMove{{PageNumber{1}, 0}, {PageNumber{4}, 4}, {PageNumber{5}, 4}},
+		},
+		{
+			name: "unrelated pages stay put",
+			ruleset: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{1}, PageNumber{2}},
+				}},
+			manual:        NewSafetyManual([]PageNumber{{2}, {3}, {1}}),
+			expected:      NewSafetyManual([]PageNumber{{3}, {1}, {2}}),
+			expectedMoves: []PageMove{{PageNumber{2}, 2}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := NewSafetyManual(test.manual.Pages())
+			moves, err := test.ruleset.CorrectMinimal(test.manual)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedMoves, moves)
+			assert.Equal(t, test.expected, test.manual)
+			assert.True(t, test.ruleset.Valid(test.manual))
+
+			// replaying the moves gives the same manual
+			for _, move := range moves {
+				move.Apply(original)
+			}
+			assert.Equal(t, test.manual, original)
+		})
+	}
+}
+
+func TestDay5_PageOrderingRuleset_CorrectMinimalCyclic(t *testing.T) {
+	ruleset := &PageOrderingRuleset{
+		rules: []PageOrderingRule{
+			{PageNumber{1}, PageNumber{2}},
+			{PageNumber{2}, PageNumber{1}},
+		}}
+	manual := NewSafetyManual([]PageNumber{{2}, {1}})
+	moves, err := ruleset.CorrectMinimal(manual)
+	assert.ErrorIs(t, err, ErrCyclicRules)
+	assert.Nil(t, moves)
+	assert.Equal(t, NewSafetyManual([]PageNumber{{2}, {1}}), manual)
+}
+
+func TestDay5_PageOrderingRuleset_CorrectMinimalIsMinimal(t *testing.T) {
+	// compare against every valid order of small manuals with rules from a fixed seed
+	rng := rand.New(rand.NewSource(5))
+	for run := 0; run < 200; run++ {
+		n := 2 + rng.Intn(5)
+		pages := []PageNumber{}
+		for _, p := range rng.Perm(n) {
+			pages = append(pages, PageNumber{p + 1})
+		}
+		// rules only ever point from a lower page to a higher one, so they never contain a cycle
+		ruleset := NewPageOrderingRuleset()
+		for left := 1; left <= n; left++ {
+			for right := left + 1; right <= n; right++ {
+				if rng.Intn(3) == 0 {
+					ruleset.AddRule(NewPageOrderingRule(PageNumber{left}, PageNumber{right}))
+				}
+			}
+		}
+
+		fewest := n
+		permutePages(append([]PageNumber{}, pages...), 0, func(order []PageNumber) {
+			if ruleset.Valid(NewSafetyManual(order)) {
+				fewest = min(fewest, n-commonSubsequence(pages, order))
+			}
+		})
+
+		manual := NewSafetyManual(pages)
+		moves, err := ruleset.CorrectMinimal(manual)
+		assert.NoError(t, err)
+		assert.True(t, ruleset.Valid(manual), "pages %v", pages)
+		assert.Len(t, moves, fewest, "pages %v rules %v", pages, ruleset.rules)
+	}
+}
+
+// permutePages calls visit with every ordering of the pages.
+func permutePages(pages []PageNumber, k int, visit func([]PageNumber)) {
+	if k == len(pages) {
+		visit(pages)
+		return
+	}
+	for i := k; i < len(pages); i++ {
+		pages[k], pages[i] = pages[i], pages[k]
+		permutePages(pages, k+1, visit)
+		pages[k], pages[i] = pages[i], pages[k]
+	}
+}
+
+// commonSubsequence returns the length of the longest common subsequence of two page orders.
+func commonSubsequence(a, b []PageNumber) int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				lengths[i+1][j+1] = lengths[i][j] + 1
+			} else {
+				lengths[i+1][j+1] = max(lengths[i][j+1], lengths[i+1][j])
+			}
+		}
+	}
+	return lengths[len(a)][len(b)]
+}
+
+func TestDay5_Parse(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		expectedRules   *PageOrderingRuleset
+		expectedManuals []*SafetyManual
+		expectedErrs    []error
+		expectedMessage string
+	}{
+		{
+			name:  "valid input",
+			input: "47|53\n97|13\n\n75,47,61,53,29\n97\n",
+			expectedRules: &PageOrderingRuleset{
+				rules: []PageOrderingRule{
+					{PageNumber{47}, PageNumber{53}},
+					{PageNumber{97}, PageNumber{13}},
+				}},
+			expectedManuals: []*SafetyManual{
+				NewSafetyManual([]PageNumber{{75}, {47}, {61}, {53}, {29}}),
+				NewSafetyManual([]PageNumber{{97}}),
+			},
+		},
+		{
+			name:            "unknown line",
+			input:           "47|53\n47-53\n\n75,47,61\n",
+			expectedRules:   NewPageOrderingRuleset(),
+			expectedManuals: []*SafetyManual{},
+			expectedErrs:    []error{ErrUnknownLine},
+			expectedMessage: "line 2: unknown line: \"47-53\"",
+		},
+		{
+			name:            "missing blank line",
+			input:           "47|53\n75,47,61\n",
+			expectedRules:   NewPageOrderingRuleset(),
+			expectedManuals: []*SafetyManual{},
+			expectedErrs:    []error{ErrMissingSeparator},
+			expectedMessage: "line 2: missing blank line between rules and manuals: manual \"75,47,61\" found before the blank line",
+		},
+		{
+			name:            "rule after blank line",
+			input:           "47|53\n\n75,47,61\n61|29\n",
+			expectedRules:   NewPageOrderingRuleset(),
+			expectedManuals: []*SafetyManual{},
+			expectedErrs:    []error{ErrUnknownLine},
+			expectedMessage: "line 4: unknown line: rule \"61|29\" found after the blank line",
+		},
+		{
+			name:            "duplicate page",
+			input:           "47|53\n\n75,47,75\n",
+			expectedRules:   NewPageOrderingRuleset(),
+			expectedManuals: []*SafetyManual{},
+			expectedErrs:    []error{ErrDuplicatePage, ErrMissingSection},
+			expectedMessage: "line 3: duplicate page in manual: page 75\nmissing section: no manuals found",
+		},
+		{
+			name:            "even manual",
+			input:           "47|53\n\n75,47\n75,47,61\n",
+			expectedRules:   NewPageOrderingRuleset(),
+			expectedManuals: []*SafetyManual{},
+			expectedErrs:    []error{ErrEvenManual},
+			expectedMessage: "line 3: manual has an even number of pages so no single middle page: 2 pages",
+		},
+		{
+			name:            "zero page",
+			input:           "0|53\n\n75,47,61\n",
+			expectedRules:   NewPageOrderingRuleset(),
+			expectedManuals: []*SafetyManual{},
+			expectedErrs:    []error{ErrInputCannotBeZero, ErrMissingSection},
+		},
+		{
+			name:            "several problems",
+			input:           "47|53\nnope\n\n75,47\n75,47,61\nalso nope\n",
+			expectedRules:   NewPageOrderingRuleset(),
+			expectedManuals: []*SafetyManual{},
+			expectedErrs:    []error{ErrUnknownLine, ErrEvenManual},
+			expectedMessage: "line 2: unknown line: \"nope\"\nline 4: manual has an even number of pages so no single middle page: 2 pages\nline 6: unknown line: \"also nope\"",
+		},
+		{
+			name:            "empty input",
+			input:           "",
+			expectedRules:   NewPageOrderingRuleset(),
+			expectedManuals: []*SafetyManual{},
+			expectedErrs:    []error{ErrMissingSection},
+			expectedMessage: "missing section: no rules found\nmissing section: no manuals found",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, manuals, err := Parse(strings.NewReader(test.input))
+			assert.Equal(t, test.expectedRules, rules)
+			assert.Equal(t, test.expectedManuals, manuals)
+			if len(test.expectedErrs) == 0 {
+				assert.NoError(t, err)
+			}
+			for _, expectedErr := range test.expectedErrs {
+				assert.ErrorIs(t, err, expectedErr)
+			}
+			if test.expectedMessage != "" {
+				assert.EqualError(t, err, test.expectedMessage)
+			}
+		})
+	}
+}
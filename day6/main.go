@@ -2,11 +2,22 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
 	"io"
 	"log"
+	"math/bits"
 	"os"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 )
 
 const (
@@ -41,11 +52,38 @@ type Guard struct {
 	positionsVisited PositionMap
 	location         Location
 	direction        Direction
+	// policy decides which way the guard turns, turning right if nil
+	policy      TurnPolicy
+	policyState int
+	// statesVisited holds the visited positions along with the policy state,
+	// for policies with more than one state
+	statesVisited map[guardState]bool
+}
+
+// guardState represents a guards position and the state of its turn policy
+type guardState struct {
+	location    Location
+	direction   Direction
+	policyState int
 }
 
 // NewGuard creates a new guard with a starting location and direction
 func NewGuard(l Location, d Direction) *Guard {
-	return &Guard{make(PositionMap), l, d}
+	return &Guard{positionsVisited: make(PositionMap), location: l, direction: d}
+}
+
+// SetTurnPolicy sets how the guard turns, starting the policy in its first state
+func (g *Guard) SetTurnPolicy(p TurnPolicy) {
+	g.policy = p
+	g.policyState = 0
+}
+
+// TurnPolicy returns how the guard turns
+func (g *Guard) TurnPolicy() TurnPolicy {
+	if g.policy == nil {
+		return TurnRight{}
+	}
+	return g.policy
 }
 
 // Move moves the guard to the new location
@@ -56,6 +94,12 @@ func (g *Guard) Move(l Location) {
 // AddVisitedPosition adds the current position to the list of visited positions
 func (g *Guard) AddVisitedPosition() {
 	g.positionsVisited[g.location] = append(g.positionsVisited[g.location], g.direction)
+	if g.TurnPolicy().States() > 1 {
+		if g.statesVisited == nil {
+			g.statesVisited = make(map[guardState]bool)
+		}
+		g.statesVisited[guardState{g.location, g.direction, g.policyState}] = true
+	}
 }
 
 // CurrentDirection returns the guards current direction
@@ -75,7 +119,12 @@ func (g *Guard) PositionsVisited() PositionMap {
 
 // DejaVu returns true if the guard has visited its current position before (in the same direction)
 // This is used to detect loops
+//
+// If the guards turn policy has more than one state, the policy must also have been in the same state.
 func (g *Guard) DejaVu() bool {
+	if g.TurnPolicy().States() > 1 {
+		return g.statesVisited[guardState{g.location, g.direction, g.policyState}]
+	}
 	if _, ok := g.positionsVisited[g.location]; ok {
 		for _, direction := range g.positionsVisited[g.location] {
 			if direction == g.direction {
@@ -119,6 +168,124 @@ func (g *Guard) turnRight() {
 	g.direction = newDirection
 }
 
+// turnLeft turns the guard to the left
+func (g *Guard) turnLeft() {
+	g.direction = (g.direction + 3) % 4
+}
+
+// turn turns the guard away from an obstruction using its turn policy
+func (g *Guard) turn() {
+	g.direction, g.policyState = g.TurnPolicy().Turn(g.direction, g.policyState)
+}
+
+// TurnPolicy represents how a guard turns when it cannot step forward
+type TurnPolicy interface {
+	// Turn returns the direction to face after turning away from direction d,
+	// and the state the policy moves to
+	Turn(d Direction, state int) (Direction, int)
+	// States returns the number of states the policy moves between, which is at least 1
+	States() int
+}
+
+// WallFollowingPolicy represents a turn policy that can also turn a guard before it steps,
+// to keep a wall beside it
+type WallFollowingPolicy interface {
+	TurnPolicy
+	// Follow returns the direction to face from direction d, given whether the location to the
+	// right of the guard is blocked, and the state the policy moves to
+	//
+	// If the direction is unchanged the guard steps forward before the policy moves to the new state.
+	Follow(d Direction, state int, rightBlocked bool) (Direction, int)
+}
+
+// TurnRight always turns the guard right, as the puzzle describes
+type TurnRight struct{}
+
+// Turn turns right
+func (TurnRight) Turn(d Direction, state int) (Direction, int) {
+	return (d + 1) % 4, state
+}
+
+// States returns 1 as the policy does not change
+func (TurnRight) States() int {
+	return 1
+}
+
+// TurnLeft always turns the guard left
+type TurnLeft struct{}
+
+// Turn turns left
+func (TurnLeft) Turn(d Direction, state int) (Direction, int) {
+	return (d + 3) % 4, state
+}
+
+// States returns 1 as the policy does not change
+func (TurnLeft) States() int {
+	return 1
+}
+
+// TurnAlternate turns the guard left, then right, then left again and so on
+type TurnAlternate struct{}
+
+// Turn turns left in the first state and right in the second
+func (TurnAlternate) Turn(d Direction, state int) (Direction, int) {
+	if state == 0 {
+		return (d + 3) % 4, 1
+	}
+	return (d + 1) % 4, 0
+}
+
+// States returns 2, for turning left next and turning right next
+func (TurnAlternate) States() int {
+	return 2
+}
+
+// TurnAround always turns the guard around to face the way it came
+type TurnAround struct{}
+
+// Turn turns around
+func (TurnAround) Turn(d Direction, state int) (Direction, int) {
+	return (d + 2) % 4, state
+}
+
+// States returns 1 as the policy does not change
+func (TurnAround) States() int {
+	return 1
+}
+
+// RightHandWall walks the guard straight until it reaches an obstruction, then follows the wall
+// it found with its right hand, turning left away from obstructions and right around corners
+type RightHandWall struct{}
+
+// the states of the RightHandWall policy
+const (
+	rightHandFree = iota
+	rightHandOnWall
+	rightHandRoundingCorner
+)
+
+// Turn turns left, keeping the obstruction on the guards right
+func (RightHandWall) Turn(d Direction, state int) (Direction, int) {
+	return (d + 3) % 4, rightHandOnWall
+}
+
+// Follow turns right around a corner when the wall on the guards right ends,
+// the guard then steps forward before checking the wall again
+func (RightHandWall) Follow(d Direction, state int, rightBlocked bool) (Direction, int) {
+	switch {
+	case state == rightHandOnWall && !rightBlocked:
+		return (d + 1) % 4, rightHandRoundingCorner
+	case state == rightHandRoundingCorner:
+		return d, rightHandOnWall
+	}
+	return d, state
+}
+
+// States returns 3, for walking free, following a wall and rounding a corner
+func (RightHandWall) States() int {
+	return 3
+}
+
 // Location represents a location on the map
 type Location struct {
 	x int
@@ -142,30 +309,74 @@ type PatrolMap map[Location]Space
 //
 // A free space is represented by a "."
 // An obstacle is represented by a "#"
-// The guard is represented by "^" and is facing up
+// Failed suit prototypes are represented by a "%", and are paired in reading order
+// A spool of very long polymers is represented by a "@"
+// A tank of universal solvent is represented by a "~"
+// The guard is represented by "^", ">", "v" or "<" for the direction it is facing
+//
+// If there is more than one guard the first, reading top to bottom and left to right, is returned.
+// Use ParseInputGuards to get every guard.
 func ParseInput(input io.Reader) (PatrolMap, *Guard, error) {
+	patrolMap, guards, err := ParseInputGuards(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	return patrolMap, guards[0], nil
+}
+
+// ParseInputGuards parses the input and returns a patrol map and every guard on it
+// in reading order (top to bottom, left to right)
+//
+// ErrInvalidPatrolMapInput is returned for any unknown character or an unpaired suit prototype,
+// and ErrInvalidGuardInput if there are no guards on the map.
+func ParseInputGuards(input io.Reader) (PatrolMap, []*Guard, error) {
 	patrolMap := make(PatrolMap)
-	var guard *Guard
+	guards := []*Guard{}
 
 	scanner := bufio.NewScanner(input)
 	for y := 0; scanner.Scan(); y++ {
 		spaces := strings.Split(scanner.Text(), "")
 		for x, space := range spaces {
-			var spaceType Space
-			switch space {
-			case ".":
-				spaceType = SpaceFree
-			case "#":
-				spaceType = SpaceCrates
-			case "^":
-				spaceType = SpaceFree
-				guard = NewGuard(Location{x, y}, DirectionUp)
+			spaceType, ok := spaceTypes[space]
+			if !ok {
+				direction, ok := guardDirections[space]
+				if !ok {
+					return nil, nil, fmt.Errorf("%w: unknown space %q at %d,%d", ErrInvalidPatrolMapInput, space, x, y)
+				}
+				// guards stand on free space
+				guards = append(guards, NewGuard(Location{x, y}, direction))
 			}
 			patrolMap[Location{x, y}] = spaceType
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(guards) == 0 {
+		return nil, nil, fmt.Errorf("%w: no guard found", ErrInvalidGuardInput)
+	}
+	if _, err := patrolMap.Behaviours(); err != nil {
+		return nil, nil, err
+	}
+	return patrolMap, guards, nil
+}
+
+// spaceTypes maps each space character to the type of space
+var spaceTypes = map[string]Space{
+	".": SpaceFree,
+	"#": SpaceCrates,
+	"%": SpaceFailedSuitPrototypes,
+	"@": SpaceSpoolOfVeryLongPolymers,
+	"~": SpaceTankOfUniversalSolvent,
+}
 
-	return patrolMap, guard, nil
+// guardDirections maps each guard character to the direction the guard is facing
+var guardDirections = map[string]Direction{
+	"^": DirectionUp,
+	">": DirectionRight,
+	"v": DirectionDown,
+	"<": DirectionLeft,
 }
 
 // Free returns true if the location is a free space
@@ -182,43 +393,1522 @@ func (pm PatrolMap) OnMap(l Location) bool {
 	return ok
 }
 
-// Patrol returns the number of distinct locations visited by the guard
-// before it leaves the map
+// Patrol moves the guard until it leaves the map or gets stuck in a loop (has seen this road before!),
+// treating end as an extra obstruction
+//
+// The map is prepared again on every call, which takes time in proportion to the area of the map.
+// Use Prepare to patrol the same map many times.
+func (pm *PatrolMap) Patrol(l Location, d Direction, end Location) *PatrolResult {
+	return pm.PatrolWithPolicy(l, d, end, TurnRight{})
+}
+
+// PatrolWithPolicy moves the guard like Patrol, turning with the given policy
+func (pm *PatrolMap) PatrolWithPolicy(l Location, d Direction, end Location, policy TurnPolicy) *PatrolResult {
+	return pm.Prepare().PatrolWithPolicy(l, d, end, policy)
+}
+
+// PreparedMap is a PatrolMap prepared for patrolling, with the guard jumping from one space
+// (other than free space) to the next rather than walking one location at a time
+//
+// Each patrol takes time in proportion to the number of spaces the guard reaches rather than the
+// area of the map, but preparing the map still takes time in proportion to its area, as a PatrolMap
+// holds every location. Maps as big as 10,000 by 10,000 are too big to hold as a PatrolMap.
+type PreparedMap struct {
+	grid *patrolGrid
+}
+
+// Prepare prepares the map for patrolling, changes made to the map afterwards are not seen
+func (pm PatrolMap) Prepare() *PreparedMap {
+	return &PreparedMap{newPatrolGrid(pm)}
+}
+
+// Patrol moves the guard like PatrolMap.Patrol
+func (m *PreparedMap) Patrol(l Location, d Direction, end Location) *PatrolResult {
+	return m.PatrolWithPolicy(l, d, end, TurnRight{})
+}
+
+// PatrolWithPolicy moves the guard like PatrolMap.PatrolWithPolicy
+func (m *PreparedMap) PatrolWithPolicy(l Location, d Direction, end Location, policy TurnPolicy) *PatrolResult {
+	return newPatroller(m.grid, policy).patrol(l, d, end)
+}
+
+// LoopExtremes returns the patrols, with each of the obstructions given, that trap the guard in
+// the longest and the shortest loops, with ties going to the first given
+//
+// ok will be false if none of the obstructions trap the guard.
+func (pm PatrolMap) LoopExtremes(l Location, d Direction, obstructions []Location) (longest, shortest *PatrolResult, ok bool) {
+	p := newPatroller(newPatrolGrid(pm), TurnRight{})
+	for _, obstruction := range obstructions {
+		result := p.patrol(l, d, obstruction)
+		if !result.Looped() {
+			continue
+		}
+		if !ok || result.CycleLength() > longest.CycleLength() {
+			longest = result
+		}
+		if !ok || result.CycleLength() < shortest.CycleLength() {
+			shortest = result
+		}
+		ok = true
+	}
+	return longest, shortest, ok
+}
+
+// FindLoopObstructions returns every location on the guards route where a single new
+// obstruction would trap the guard in a loop, in reading order (top to bottom, left to right)
 //
-// nil will be returned if the guard gets stuck in a loop (has seen this road before!)
-func (pm *PatrolMap) Patrol(l Location, d Direction, end Location) PositionMap {
-	// setup the guard
-	guard := NewGuard(l, d)
+// Each location is tried on a pool of workers, one for each CPU Go may use, and the search
+// stops early with the context's error if the context is cancelled.
+func (pm PatrolMap) FindLoopObstructions(ctx context.Context, l Location, d Direction) ([]Location, error) {
+	grid := newPatrolGrid(pm)
+	route := newPatroller(grid, TurnRight{}).patrol(l, d, Location{-1, -1})
+	if route.Looped() {
+		// the guard loops without any help
+		return []Location{}, nil
+	}
+	// obstructions can only be added to free space
+	candidates := []Location{}
+	for _, candidate := range route.Visited().Locations() {
+		if pm[candidate] == SpaceFree {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	// try each candidate on a worker, storing results by index so the order is deterministic
+	loops := make([]bool, len(candidates))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := newPatroller(grid, TurnRight{})
+			for i := range jobs {
+				loops[i] = p.loops(l, d, candidates[i])
+			}
+		}()
+	}
+
+	var err error
+dispatch:
+	for i := range candidates {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break dispatch
+		case jobs <- i:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	obstructions := []Location{}
+	for i, loop := range loops {
+		if loop {
+			obstructions = append(obstructions, candidates[i])
+		}
+	}
+	return obstructions, nil
+}
+
+// Collision decides what happens when guards patrolling together meet
+type Collision int
+
+const (
+	// CollisionPassThrough lets guards walk through each other as if they were not there
+	CollisionPassThrough Collision = iota
+	// CollisionBlock makes guards treat each other as obstacles, turning rather than
+	// stepping into a location another guard is in or has just stepped into
+	CollisionBlock
+	// CollisionHalt stops guards where they meet, either in the same location or
+	// by swapping locations, and they patrol no further
+	CollisionHalt
+)
+
+// PatrolTogether moves every guard at the same time, one step or turn each in turn, until they
+// have all left the map, halted, or are stuck in a loop, returning the distinct locations visited
+// by each guard
+//
+// nil will be returned for a guard that gets stuck in a loop. Unless the guards pass through each
+// other, they are only stuck once every guard still patrolling is back where they all were before.
+// The guards given are not moved.
+func (pm PatrolMap) PatrolTogether(guards []*Guard, collision Collision) []*Visited {
+	grid := newPatrolGrid(pm)
+
+	// each guard patrols with its own copy so that the given guards are not moved
+	type patrol struct {
+		guard     Guard
+		cells     bitset
+		count     int
+		steps     int
+		positions bitset
+		active    bool
+		looped    bool
+	}
+	patrols := make([]*patrol, len(guards))
+	for i, g := range guards {
+		patrols[i] = &patrol{
+			guard:     Guard{location: g.location, direction: g.direction, policy: g.policy, policyState: g.policyState},
+			cells:     newBitset(grid.width * grid.height),
+			positions: newBitset(grid.width * grid.height * 4 * g.TurnPolicy().States()),
+			active:    true,
+		}
+	}
+
+	// states seen by the guards still patrolling together, for loop detection
+	seen := map[string]bool{}
 	for {
-		// if off map return list of found positions
-		if !pm.OnMap(guard.CurrentLocation()) {
-			return guard.PositionsVisited()
+		// guards off the map have left it, the rest track their position
+		var state strings.Builder
+		for i, p := range patrols {
+			if !p.active {
+				continue
+			}
+			cell, onMap := grid.index(p.guard.location)
+			if !onMap {
+				p.active = false
+				continue
+			}
+			if !p.cells.has(cell) {
+				p.cells.set(cell)
+				p.count++
+			}
+			position := (cell*4+int(p.guard.direction))*p.guard.TurnPolicy().States() + p.guard.policyState
+			if collision == CollisionPassThrough && p.positions.has(position) {
+				// if dejavu then the guard is on its own loop
+				p.active, p.looped = false, true
+				continue
+			}
+			p.positions.set(position)
+			fmt.Fprintf(&state, "%d:%d;", i, position)
+		}
+		if state.Len() == 0 {
+			break
+		}
+		if collision != CollisionPassThrough && seen[state.String()] {
+			// every guard still patrolling is stuck in the same loop together
+			for _, p := range patrols {
+				p.looped = p.looped || p.active
+			}
+			break
+		}
+		if collision != CollisionPassThrough {
+			seen[state.String()] = true
 		}
-		// if dejavu return nil (for loop detection)
-		if guard.DejaVu() {
+
+		// where each guard was at the start of the step, and where they are after moving
+		was := make([]Location, len(patrols))
+		for i, p := range patrols {
+			was[i] = p.guard.location
+		}
+		occupied := func(l Location, guard int) bool {
+			for i, p := range patrols {
+				if i != guard && (p.active || !p.looped) && (was[i] == l || p.guard.location == l) {
+					return true
+				}
+			}
+			return false
+		}
+
+		for i, p := range patrols {
+			if !p.active {
+				continue
+			}
+			var blocked func(Location) bool
+			if collision == CollisionBlock {
+				blocked = func(l Location) bool { return occupied(l, i) }
+			}
+			steps, _ := grid.act(&p.guard, blocked)
+			p.steps += steps
+		}
+
+		if collision == CollisionHalt {
+			halt := make([]bool, len(patrols))
+			for i, a := range patrols {
+				for j, b := range patrols {
+					if i == j || a.looped || b.looped {
+						continue
+					}
+					if _, onMap := grid.index(a.guard.location); !onMap {
+						continue
+					}
+					// meeting in a location, or swapping locations as they pass
+					met := a.guard.location == b.guard.location
+					swapped := a.guard.location == was[j] && b.guard.location == was[i] && was[i] != was[j]
+					if (a.active || b.active) && (met || swapped) {
+						halt[i] = true
+					}
+				}
+			}
+			for i, p := range patrols {
+				if halt[i] && p.active {
+					// the guard halts where it met the other guard
+					if cell, _ := grid.index(p.guard.location); !p.cells.has(cell) {
+						p.cells.set(cell)
+						p.count++
+					}
+					p.active = false
+				}
+			}
+		}
+	}
+
+	visited := make([]*Visited, len(patrols))
+	for i, p := range patrols {
+		if !p.looped {
+			visited[i] = &Visited{grid: grid, cells: p.cells, count: p.count, steps: p.steps}
+		}
+	}
+	return visited
+}
+
+// MinObstructionsAvoiding returns the smallest set of at most k new obstructions that keeps the guard
+// from ever reaching the target, in reading order (top to bottom, left to right)
+//
+// Obstructions can be added to any free space the guard would walk through on the way to the target,
+// apart from where it starts and the target itself. ok will be false if k obstructions are not enough.
+func (pm PatrolMap) MinObstructionsAvoiding(l Location, d Direction, target Location, k int) (obstructions []Location, ok bool) {
+	candidates := func(result *PatrolResult) []Location {
+		// only the route up to the target can be changed
+		locations := []Location{}
+		for _, event := range result.Events() {
+			if event.location == target {
+				break
+			}
+			if event.kind == EventMove && event.location != l && pm[event.location] == SpaceFree {
+				locations = append(locations, event.location)
+			}
+		}
+		return locations
+	}
+	avoided := func(result *PatrolResult) bool {
+		return !result.Visited().Contains(target)
+	}
+	return pm.minChanges(l, d, k, SpaceCrates, candidates, avoided)
+}
+
+// MinCratesToFree returns the smallest set of at most k crates that, if removed, lets the guard
+// leave the map rather than getting stuck in a loop, in reading order (top to bottom, left to right)
+//
+// ok will be false if removing k crates is not enough.
+func (pm PatrolMap) MinCratesToFree(l Location, d Direction, k int) (crates []Location, ok bool) {
+	candidates := func(result *PatrolResult) []Location {
+		// only the crates the guard walks into change its route
+		locations := []Location{}
+		for _, event := range result.Events() {
+			if event.kind == EventObstruction && pm[event.obstruction] == SpaceCrates {
+				locations = append(locations, event.obstruction)
+			}
+		}
+		return locations
+	}
+	freed := func(result *PatrolResult) bool {
+		return result.Exited()
+	}
+	return pm.minChanges(l, d, k, SpaceFree, candidates, freed)
+}
+
+// minChanges returns the smallest set of at most k locations that, when changed to the given type
+// of space, makes the patrol done, in reading order (top to bottom, left to right)
+//
+// Each set is grown from the candidates the patrol so far returns, trying sets of each size in turn
+// so the first set found is the smallest.
+func (pm PatrolMap) minChanges(l Location, d Direction, k int, change Space, candidates func(*PatrolResult) []Location, done func(*PatrolResult) bool) ([]Location, bool) {
+	// make the changes on a prepared copy, so the given map is left alone and only prepared once
+	changed := pm.Prepare()
+
+	var search func(chosen []Location, size int, tried map[string]bool) []Location
+	search = func(chosen []Location, size int, tried map[string]bool) []Location {
+		result := changed.Patrol(l, d, Location{-1, -1})
+		if done(result) {
+			return chosen
+		}
+		if len(chosen) == size {
 			return nil
 		}
-		// Track visited position
-		guard.AddVisitedPosition()
-		// get next location
-		newLocation := guard.NextLocation(*pm)
-		// if obstacle in front or the given location (the given pretend loop obstruction) then change direction
-		if !pm.Free(newLocation) || newLocation == end {
-			if pm.OnMap(newLocation) {
-				guard.turnRight()
-			} else {
-				guard.Move(newLocation)
+		for _, candidate := range candidates(result) {
+			// the patrol only depends on which locations are changed, not the order they are changed in
+			next := sortLocations(append(append([]Location{}, chosen...), candidate))
+			key := fmt.Sprint(next)
+			if tried[key] {
+				continue
+			}
+			tried[key] = true
+
+			changed.grid.set(candidate, change)
+			found := search(next, size, tried)
+			changed.grid.set(candidate, pm[candidate])
+			if found != nil {
+				return found
 			}
-		} else {
-			// otherwise move forward
-			guard.Move(newLocation)
 		}
+		return nil
+	}
+
+	for size := 0; size <= k; size++ {
+		if found := search([]Location{}, size, map[string]bool{}); found != nil {
+			return found, true
+		}
+	}
+	return nil, false
+}
+
+// sortLocations sorts the locations in reading order (top to bottom, left to right)
+func sortLocations(locations []Location) []Location {
+	sort.Slice(locations, func(i, j int) bool {
+		if locations[i].y != locations[j].y {
+			return locations[i].y < locations[j].y
+		}
+		return locations[i].x < locations[j].x
+	})
+	return locations
+}
+
+// PatrolResult represents how a guards patrol ended, either by leaving the map or by getting
+// stuck in a loop
+//
+// Steps are counted the same way as Visited.Steps, so a loop through a tank of universal solvent
+// is longer than one that goes around it.
+type PatrolResult struct {
+	grid    *patrolGrid
+	visited *Visited
+	looped  bool
+	exit    Location
+	steps   int
+	// the loop, if the guard got stuck in one
+	loopStart   int
+	cycleLength int
+	cycle       []Location
+	turns       []Turn
+	// how the guard got there, for replaying the patrol
+	start       Guard
+	obstruction Location
+	trace       *trace
+}
+
+// Visited returns the distinct locations visited by the guard, up to the point it left the map
+// or realised it was in a loop
+//
+// The locations are marked from the route the patrol recorded the first time they are asked for.
+func (r *PatrolResult) Visited() *Visited {
+	if r.visited == nil {
+		v := &Visited{grid: r.grid, cells: newBitset(r.grid.width * r.grid.height), steps: r.steps}
+		for _, run := range r.trace.runs {
+			for x, y, n := run.x, run.y, run.n; n > 0; n-- {
+				i := y*r.grid.width + x
+				if !v.cells.has(i) {
+					v.cells.set(i)
+					v.count++
+				}
+				x, y = step(x, y, run.d)
+			}
+		}
+		r.visited = v
+	}
+	return r.visited
+}
+
+// Looped returns true if the guard got stuck in a loop
+func (r *PatrolResult) Looped() bool {
+	return r.looped
+}
+
+// Exited returns true if the guard left the map
+func (r *PatrolResult) Exited() bool {
+	return !r.looped
+}
+
+// Exit returns the last location the guard was on before leaving the map
+func (r *PatrolResult) Exit() Location {
+	return r.exit
+}
+
+// Steps returns the number of steps the guard took before leaving the map,
+// or before realising it was in a loop
+func (r *PatrolResult) Steps() int {
+	return r.steps
+}
+
+// LoopStart returns the step at which the guard entered the loop, the first time it was somewhere
+// on the loop facing the same way (and with its turn policy in the same state) as going around it
+func (r *PatrolResult) LoopStart() int {
+	return r.loopStart
+}
+
+// CycleLength returns the number of steps it takes the guard to go around the loop once
+func (r *PatrolResult) CycleLength() int {
+	return r.cycleLength
+}
+
+// Cycle returns the locations the guard walks through going around the loop once,
+// starting where it entered the loop
+func (r *PatrolResult) Cycle() []Location {
+	return r.cycle
+}
+
+// Turns returns the turns the guard makes going around the loop once,
+// starting where it entered the loop
+func (r *PatrolResult) Turns() []Turn {
+	return r.turns
+}
+
+// Obstruction returns the extra obstruction the guard patrolled with
+func (r *PatrolResult) Obstruction() Location {
+	return r.obstruction
+}
+
+// EventKind represents the kind of thing that happened to a guard on a patrol
+type EventKind int
+
+const (
+	// EventMove is the guard moving, one step forward unless a space moved it further
+	EventMove EventKind = iota
+	// EventObstruction is the guard being blocked by the obstruction in front of it
+	EventObstruction
+	// EventTurn is the guard turning without moving
+	EventTurn
+)
+
+// Event represents something that happened to a guard on a patrol
+type Event struct {
+	kind        EventKind
+	steps       int
+	location    Location
+	direction   Direction
+	obstruction Location
+}
+
+// Kind returns the kind of event
+func (e Event) Kind() EventKind {
+	return e.kind
+}
+
+// Steps returns the number of steps the guard had taken after the event
+func (e Event) Steps() int {
+	return e.steps
+}
+
+// Location returns where the guard was after the event, which is off the map for its last move
+// if it left the map
+func (e Event) Location() Location {
+	return e.location
+}
+
+// Direction returns the direction the guard was facing after the event
+func (e Event) Direction() Direction {
+	return e.direction
+}
+
+// Obstruction returns the location of the obstruction that blocked the guard, for an EventObstruction
+func (e Event) Obstruction() Location {
+	return e.obstruction
+}
+
+// Events returns everything that happened to the guard, step by step, until it left the map
+// or realised it was in a loop
+//
+// The events are replayed from the route the patrol recorded, so they cost nothing unless asked for.
+func (r *PatrolResult) Events() []Event {
+	g := r.grid
+	events := []Event{}
+	for i, run := range r.trace.runs {
+		// walk along the run
+		steps := 0
+		if i > 0 {
+			steps = r.trace.stops[i-1].afterSteps
+		}
+		x, y := run.x, run.y
+		for n := run.n; n > 1; n-- {
+			x, y = step(x, y, run.d)
+			steps++
+			events = append(events, Event{kind: EventMove, steps: steps, location: Location{x + g.minX, y + g.minY}, direction: run.d})
+		}
+		if i == len(r.trace.stops) {
+			// off the map
+			if !r.looped {
+				x, y = step(x, y, run.d)
+				events = append(events, Event{kind: EventMove, steps: steps, location: Location{x + g.minX, y + g.minY}, direction: run.d})
+			}
+			break
+		}
+
+		// then try to step into the stop at the end of it
+		stop := r.trace.stops[i]
+		before, after := stop.guard, stop.after
+		if after.location != before.location {
+			events = append(events, Event{kind: EventMove, steps: stop.afterSteps, location: after.location, direction: after.direction})
+			continue
+		}
+		if stop.stepped {
+			events = append(events, Event{kind: EventObstruction, steps: stop.afterSteps, location: before.location, direction: before.direction, obstruction: before.NextLocation(nil)})
+		}
+		if after.direction != before.direction {
+			events = append(events, Event{kind: EventTurn, steps: stop.afterSteps, location: after.location, direction: after.direction})
+		}
+	}
+	return events
+}
+
+// RenderFrames returns the patrol as a series of frames, the map before the first event and after
+// each event, with the guard shown by the direction it is facing and the locations it visited by an "X"
+//
+// The temporary obstruction, if on the map, is shown by an "O".
+func (pm PatrolMap) RenderFrames(r *PatrolResult) []string {
+	base := pm.render(r)
+	g := r.grid
+	guard := r.start
+	events := r.Events()
+
+	frames := make([]string, 0, len(events)+1)
+	frame := func() string {
+		rows := make([][]byte, len(base))
+		for y := range base {
+			rows[y] = append([]byte{}, base[y]...)
+		}
+		if i, onMap := g.index(guard.location); onMap {
+			rows[i/g.width][i%g.width] = guardGlyph(guard.direction)
+		}
+		return string(bytes.Join(rows, []byte("\n")))
+	}
+
+	frames = append(frames, frame())
+	for _, event := range events {
+		// the guard leaves a trail of visited free space behind it
+		if pm[guard.location] == SpaceFree {
+			base[guard.location.y-g.minY][guard.location.x-g.minX] = 'X'
+		}
+		guard.location, guard.direction = event.location, event.direction
+		frames = append(frames, frame())
+	}
+	return frames
+}
+
+// RenderTrails returns the map with the route the guard took drawn over the free space, as the
+// puzzle does, with "|" for walking up or down, "-" for walking left or right, and "+" for both or
+// for turning
+//
+// The guard is shown where it started, facing the direction it started in, and the temporary
+// obstruction, if on the map, is shown by an "O".
+func (pm PatrolMap) RenderTrails(r *PatrolResult) string {
+	rows := pm.render(r)
+	g := r.grid
+
+	// mark each location with the ways the guard walked through it
+	const (
+		vertical = 1 << iota
+		horizontal
+		turned
+	)
+	trails := make(map[Location]int)
+	axis := func(d Direction) int {
+		if d == DirectionUp || d == DirectionDown {
+			return vertical
+		}
+		return horizontal
+	}
+	guard := r.start
+	for _, event := range r.Events() {
+		switch event.kind {
+		case EventMove:
+			trails[guard.location] |= axis(guard.direction)
+			trails[event.location] |= axis(event.direction)
+		case EventTurn:
+			trails[event.location] |= turned
+		}
+		guard.location, guard.direction = event.location, event.direction
+	}
+
+	for l, trail := range trails {
+		if pm[l] != SpaceFree || !pm.OnMap(l) || l == r.obstruction {
+			continue
+		}
+		glyph := byte('+')
+		switch trail {
+		case vertical:
+			glyph = '|'
+		case horizontal:
+			glyph = '-'
+		}
+		rows[l.y-g.minY][l.x-g.minX] = glyph
+	}
+	if i, onMap := g.index(r.start.location); onMap {
+		rows[i/g.width][i%g.width] = guardGlyph(r.start.direction)
+	}
+	return string(bytes.Join(rows, []byte("\n")))
+}
+
+// the colours used to draw patrols
+var patrolPalette = color.Palette{
+	color.White,                        // free space
+	color.Black,                        // crates
+	color.RGBA{0xcc, 0xcc, 0xcc, 0xff}, // holes in the map
+	color.RGBA{0x44, 0x88, 0xee, 0xff}, // visited
+	color.RGBA{0xee, 0x22, 0x22, 0xff}, // the guard
+	color.RGBA{0xff, 0x99, 0x00, 0xff}, // the temporary obstruction
+	color.RGBA{0x99, 0x44, 0xcc, 0xff}, // failed suit prototypes
+	color.RGBA{0x22, 0x99, 0x44, 0xff}, // spools of very long polymers
+	color.RGBA{0x44, 0xdd, 0xdd, 0xff}, // tanks of universal solvent
+}
+
+// the index in the patrolPalette of each colour
+const (
+	paletteFree = iota
+	paletteCrates
+	paletteHole
+	paletteVisited
+	paletteGuard
+	paletteObstruction
+	paletteSuitPrototypes
+	palettePolymers
+	paletteSolvent
+)
+
+// WriteGIF writes the patrol as an animated GIF, with a frame before the first event and after
+// each event, each location drawn as a square of scale pixels (at least 1)
+func (pm PatrolMap) WriteGIF(w io.Writer, r *PatrolResult, scale int) error {
+	scale = max(scale, 1)
+	g := r.grid
+	bounds := image.Rect(0, 0, g.width*scale, g.height*scale)
+
+	// draw the map once, then the trail onto it as the guard moves
+	spaceColours := map[Space]uint8{
+		SpaceFree:                    paletteFree,
+		SpaceCrates:                  paletteCrates,
+		SpaceFailedSuitPrototypes:    paletteSuitPrototypes,
+		SpaceSpoolOfVeryLongPolymers: palettePolymers,
+		SpaceTankOfUniversalSolvent:  paletteSolvent,
+	}
+	base := image.NewPaletted(bounds, patrolPalette)
+	fill := func(img *image.Paletted, l Location, colour uint8) {
+		x, y := (l.x-g.minX)*scale, (l.y-g.minY)*scale
+		for dy := 0; dy < scale; dy++ {
+			for dx := 0; dx < scale; dx++ {
+				img.SetColorIndex(x+dx, y+dy, colour)
+			}
+		}
+	}
+	for i := 0; i < g.width*g.height; i++ {
+		l := g.location(i)
+		colour := uint8(paletteHole)
+		if space, onMap := pm[l]; onMap {
+			colour = spaceColours[space]
+		}
+		fill(base, l, colour)
+	}
+	if pm.OnMap(r.obstruction) {
+		fill(base, r.obstruction, paletteObstruction)
+	}
+
+	anim := &gif.GIF{}
+	guard := r.start
+	frame := func() {
+		img := image.NewPaletted(bounds, patrolPalette)
+		copy(img.Pix, base.Pix)
+		if pm.OnMap(guard.location) {
+			fill(img, guard.location, paletteGuard)
+		}
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, 10)
+	}
+
+	frame()
+	for _, event := range r.Events() {
+		if pm[guard.location] == SpaceFree {
+			fill(base, guard.location, paletteVisited)
+		}
+		guard.location, guard.direction = event.location, event.direction
+		frame()
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// render returns the rows of the map the patrol happened on, without the guard,
+// showing the temporary obstruction by an "O" if it is on the map
+func (pm PatrolMap) render(r *PatrolResult) [][]byte {
+	g := r.grid
+	rows := make([][]byte, g.height)
+	for y := range rows {
+		rows[y] = bytes.Repeat([]byte(" "), g.width)
+	}
+	for l, space := range pm {
+		rows[l.y-g.minY][l.x-g.minX] = spaceGlyph(space)
+	}
+	if pm.OnMap(r.obstruction) {
+		rows[r.obstruction.y-g.minY][r.obstruction.x-g.minX] = 'O'
+	}
+	return rows
+}
+
+// spaceGlyph returns the character representing the type of space
+func spaceGlyph(space Space) byte {
+	for glyph, spaceType := range spaceTypes {
+		if spaceType == space {
+			return glyph[0]
+		}
+	}
+	return '?'
+}
+
+// guardGlyph returns the character representing a guard facing the direction
+func guardGlyph(d Direction) byte {
+	for glyph, direction := range guardDirections {
+		if direction == d {
+			return glyph[0]
+		}
+	}
+	return '?'
+}
+
+// Turn represents a guard turning without moving
+type Turn struct {
+	location Location
+	from     Direction
+	to       Direction
+}
+
+// Location returns where the guard turned
+func (t Turn) Location() Location {
+	return t.location
+}
+
+// From returns the direction the guard was facing before turning
+func (t Turn) From() Direction {
+	return t.from
+}
+
+// To returns the direction the guard was facing after turning
+func (t Turn) To() Direction {
+	return t.to
+}
+
+// Visited represents the set of distinct locations a guard visited on a patrol
+type Visited struct {
+	grid  *patrolGrid
+	cells bitset
+	count int
+	steps int
+}
+
+// Len returns the number of distinct locations visited
+func (v *Visited) Len() int {
+	return v.count
+}
+
+// Steps returns the number of steps the guard took around the map, including
+// the extra steps taken wading through any tanks of universal solvent
+func (v *Visited) Steps() int {
+	return v.steps
+}
+
+// Contains returns true if the guard visited the location
+func (v *Visited) Contains(l Location) bool {
+	i, ok := v.grid.index(l)
+	return ok && v.cells.has(i)
+}
+
+// Locations returns the locations visited in reading order (top to bottom, left to right)
+func (v *Visited) Locations() []Location {
+	locations := make([]Location, 0, v.count)
+	for w, word := range v.cells {
+		// skip straight past the parts of the map that were not visited
+		for ; word != 0; word &= word - 1 {
+			locations = append(locations, v.grid.location(w*64+bits.TrailingZeros64(word)))
+		}
+	}
+	return locations
+}
+
+// patrolGrid is a compact copy of a PatrolMap, with each location given an index
+// so that visited locations can be tracked in a bitset rather than a map
+//
+// Only the stops (any space other than free space, and holes in the map) are kept for each row
+// and column, in order, so the guard can jump straight to the next stop rather than walking one
+// location at a time.
+type patrolGrid struct {
+	minX   int
+	minY   int
+	width  int
+	height int
+	onMap  bitset
+	rows   [][]stop
+	cols   [][]stop
+	// spaces holds the type of space at each stop, by id
+	spaces     []Space
+	behaviours map[Space]SpaceBehaviour
+}
+
+// stop is a space or hole at a position along a row or column of the patrolGrid
+type stop struct {
+	at int
+	// id identifies the space, holes in the map have an id of noSpace
+	id int
+}
+
+// noSpace is the id of a stop that is a hole in the map rather than a space
+const noSpace = -1
+
+// newPatrolGrid creates a patrolGrid covering every location of the patrol map
+func newPatrolGrid(pm PatrolMap) *patrolGrid {
+	g := &patrolGrid{}
+	if len(pm) == 0 {
+		return g
+	}
+
+	// find the bounds of the map
+	maxX, maxY := 0, 0
+	first := true
+	for l := range pm {
+		if first {
+			g.minX, g.minY, maxX, maxY = l.x, l.y, l.x, l.y
+			first = false
+		}
+		g.minX, g.minY = min(g.minX, l.x), min(g.minY, l.y)
+		maxX, maxY = max(maxX, l.x), max(maxY, l.y)
+	}
+	g.width, g.height = maxX-g.minX+1, maxY-g.minY+1
+	g.rows = make([][]stop, g.height)
+	g.cols = make([][]stop, g.width)
+
+	// spaces other than free space are stops where the guard might turn or move elsewhere,
+	// an unpaired suit prototype just lets the guard through
+	g.behaviours, _ = pm.Behaviours()
+	g.onMap = newBitset(g.width * g.height)
+	for l, space := range pm {
+		x, y := l.x-g.minX, l.y-g.minY
+		g.onMap.set(y*g.width + x)
+		if space != SpaceFree {
+			g.addStop(x, y, len(g.spaces))
+			g.spaces = append(g.spaces, space)
+		}
+	}
+	// holes are stops where the guard leaves the map
+	for i := 0; i < g.width*g.height; i++ {
+		if !g.onMap.has(i) {
+			g.addStop(i%g.width, i/g.width, noSpace)
+		}
+	}
+
+	for _, line := range append(g.rows, g.cols...) {
+		sort.Slice(line, func(i, j int) bool { return line[i].at < line[j].at })
+	}
+	return g
+}
+
+// addStop adds a stop to the row and column it is in
+func (g *patrolGrid) addStop(x, y, id int) {
+	g.rows[y] = append(g.rows[y], stop{x, id})
+	g.cols[x] = append(g.cols[x], stop{y, id})
+}
+
+// set changes the type of space at a location on the map, updating the stops in its row and column
+//
+// Spaces that need pairing with others, like suit prototypes, cannot be set. Setting free space
+// back where the last space was added reuses its id, so patrols can keep trying and undoing changes.
+func (g *patrolGrid) set(l Location, space Space) {
+	i, ok := g.index(l)
+	if !ok {
+		return
+	}
+	x, y := i%g.width, i/g.width
+	row := sort.Search(len(g.rows[y]), func(i int) bool { return g.rows[y][i].at >= x })
+	if row < len(g.rows[y]) && g.rows[y][row].at == x {
+		id := g.rows[y][row].id
+		if space != SpaceFree {
+			g.spaces[id] = space
+			return
+		}
+		col := sort.Search(len(g.cols[x]), func(i int) bool { return g.cols[x][i].at >= y })
+		g.rows[y] = append(g.rows[y][:row], g.rows[y][row+1:]...)
+		g.cols[x] = append(g.cols[x][:col], g.cols[x][col+1:]...)
+		if id == len(g.spaces)-1 {
+			g.spaces = g.spaces[:id]
+		}
+		return
+	}
+	if space == SpaceFree {
+		return
+	}
+
+	id := len(g.spaces)
+	g.spaces = append(g.spaces, space)
+	col := sort.Search(len(g.cols[x]), func(i int) bool { return g.cols[x][i].at >= y })
+	g.rows[y] = slices.Insert(g.rows[y], row, stop{x, id})
+	g.cols[x] = slices.Insert(g.cols[x], col, stop{y, id})
+}
+
+// index returns the index of a location, and false if the location is not on the map
+func (g *patrolGrid) index(l Location) (int, bool) {
+	x, y := l.x-g.minX, l.y-g.minY
+	if x < 0 || y < 0 || x >= g.width || y >= g.height {
+		return 0, false
+	}
+	i := y*g.width + x
+	return i, g.onMap.has(i)
+}
+
+// location returns the location at an index
+func (g *patrolGrid) location(i int) Location {
+	return Location{i%g.width + g.minX, i/g.width + g.minY}
+}
+
+// behaviour returns the behaviour of the space at a stop, the temporary obstruction
+// (with the id after the last space) behaves like crates
+func (g *patrolGrid) behaviour(id int) SpaceBehaviour {
+	if id == len(g.spaces) {
+		return Crates{}
+	}
+	return g.behaviours[g.spaces[id]]
+}
+
+// behaviourAt returns the behaviour of the space at a location on the map
+func (g *patrolGrid) behaviourAt(l Location) SpaceBehaviour {
+	x, y := l.x-g.minX, l.y-g.minY
+	line := g.rows[y]
+	i := sort.Search(len(line), func(i int) bool { return line[i].at >= x })
+	if i < len(line) && line[i].at == x {
+		return g.behaviour(line[i].id)
+	}
+	return FreeSpace{}
+}
+
+// blocks returns true if the guard would not move when stepping into the location,
+// with blocked deciding any other locations it cannot step into
+func (g *patrolGrid) blocks(guard *Guard, l Location, blocked func(Location) bool) bool {
+	if _, onMap := g.index(l); !onMap {
+		return false
+	}
+	if blocked != nil && blocked(l) {
+		return true
+	}
+	probe := *guard
+	g.behaviourAt(l).Enter(&probe, l)
+	return probe.location == guard.location
+}
+
+// act moves or turns the guard once, with blocked deciding any other locations it cannot step into,
+// returning the number of steps taken and false if the guard turned to follow a wall rather than
+// trying to step forward
+func (g *patrolGrid) act(guard *Guard, blocked func(Location) bool) (int, bool) {
+	// a guard following a wall might turn before stepping
+	before, state := guard.location, guard.policyState
+	if wall, ok := guard.TurnPolicy().(WallFollowingPolicy); ok {
+		right := *guard
+		right.turnRight()
+		var d Direction
+		d, state = wall.Follow(guard.direction, guard.policyState, g.blocks(guard, right.NextLocation(nil), blocked))
+		if d != guard.direction {
+			guard.direction, guard.policyState = d, state
+			return 0, false
+		}
+	}
+
+	newLocation := guard.NextLocation(nil)
+	_, onMap := g.index(newLocation)
+	steps := 0
+	switch {
+	case !onMap:
+		guard.Move(newLocation)
+	case blocked != nil && blocked(newLocation):
+		guard.turn()
+	default:
+		// let the space decide where the guard goes
+		steps = g.behaviourAt(newLocation).Enter(guard, newLocation)
+	}
+	if guard.location != before {
+		guard.policyState = state
+	}
+	return steps, true
+}
+
+// next returns the first stop in front of a guard at x, y facing in the direction,
+// and false if the guard can walk off the edge of the map without stopping
+//
+// The position of the stop is along the guards row (when facing left or right)
+// or column (when facing up or down).
+func (g *patrolGrid) next(x, y int, d Direction) (stop, bool) {
+	switch d {
+	case DirectionUp:
+		return before(g.cols[x], y)
+	case DirectionRight:
+		return after(g.rows[y], x)
+	case DirectionDown:
+		return after(g.cols[x], y)
+	default:
+		return before(g.rows[y], x)
+	}
+}
+
+// after returns the first stop in the line after the position
+func after(line []stop, at int) (stop, bool) {
+	i := sort.Search(len(line), func(i int) bool { return line[i].at > at })
+	if i == len(line) {
+		return stop{}, false
+	}
+	return line[i], true
+}
+
+// before returns the last stop in the line before the position
+func before(line []stop, at int) (stop, bool) {
+	i := sort.Search(len(line), func(i int) bool { return line[i].at >= at })
+	if i == 0 {
+		return stop{}, false
+	}
+	return line[i-1], true
+}
+
+// patroller walks a guard around a patrolGrid, reusing its bitsets between patrols
+type patroller struct {
+	grid   *patrolGrid
+	policy TurnPolicy
+	// reached holds the stops reached, the direction they were reached in and the policy state
+	reached bitset
+	touched []int
+}
+
+// newPatroller creates a patroller for the grid, with guards turning using the policy
+func newPatroller(g *patrolGrid, policy TurnPolicy) *patroller {
+	return &patroller{
+		grid:   g,
+		policy: policy,
+		// leave room for the temporary obstruction
+		reached: newBitset((len(g.spaces) + 1) * 4 * policy.States()),
+	}
+}
+
+// trace records the runs walked and the stops reached on a patrol, so the patrol can be described
+//
+// Each run is followed by the stop reached at the end of it, apart from the last run if the guard
+// walked off the map at the end of it.
+type trace struct {
+	runs  []run
+	stops []reachedStop
+	// first holds the index of the first time each stop was reached in each direction
+	first map[int]int
+	// loop is the index of the stop the guard was reaching when it realised it was in a loop
+	loop int
+}
+
+// tracedState is a state the guard was in on a patrol, and the steps taken to get there
+type tracedState struct {
+	guardState
+	steps int
+}
+
+// states returns the states the guard was in, one for each location walked through,
+// on the runs from the i'th onwards
+func (t *trace) states(g *patrolGrid, i int) []tracedState {
+	states := []tracedState{}
+	for ; i < len(t.runs); i++ {
+		r := t.runs[i]
+		// each run after the first follows a stop
+		policyState, steps := 0, 0
+		if i > 0 {
+			policyState, steps = t.stops[i-1].after.policyState, t.stops[i-1].afterSteps
+		}
+		for x, y, n := r.x, r.y, 0; n < r.n; n++ {
+			states = append(states, tracedState{guardState{Location{x + g.minX, y + g.minY}, r.d, policyState}, steps + n})
+			x, y = step(x, y, r.d)
+		}
+	}
+	return states
+}
+
+// run is a straight line of n locations walked from x, y
+type run struct {
+	x, y int
+	d    Direction
+	n    int
+}
+
+// reachedStop is the guard in front of a stop and the steps taken to get there,
+// along with where the guard was after trying to step into the stop
+type reachedStop struct {
+	guard      Guard
+	steps      int
+	after      Guard
+	afterSteps int
+	// stepped is false if the guard turned to follow a wall, rather than trying to step into the stop
+	stepped bool
+}
+
+// patrol moves the guard until it leaves the map or gets stuck in a loop, treating end as an extra obstruction
+func (p *patroller) patrol(l Location, d Direction, end Location) *PatrolResult {
+	t := &trace{first: make(map[int]int)}
+	looped, steps := p.walk(l, d, end, t)
+	result := &PatrolResult{
+		grid:        p.grid,
+		looped:      looped,
+		steps:       steps,
+		start:       Guard{location: l, direction: d},
+		obstruction: end,
+		trace:       t,
+	}
+
+	if !looped {
+		if len(t.runs) > 0 {
+			last := t.runs[len(t.runs)-1]
+			x, y := jump(last.x, last.y, last.d, last.n-1)
+			result.exit = Location{x + p.grid.minX, y + p.grid.minY}
+		}
+		return result
+	}
+
+	// going around the loop once starts just after the stop that was reached twice,
+	// and ends in front of it again
+	result.cycleLength = steps - t.stops[t.loop].steps
+	around := t.states(p.grid, t.loop+1)
+	onLoop := make(map[guardState]int, len(around))
+	for i, s := range around {
+		onLoop[s.guardState] = i
+	}
+
+	// the guard entered the loop at the first state it was in that is on the loop,
+	// which might be well before it reached the stop the first time
+	for _, s := range t.states(p.grid, 0) {
+		if i, ok := onLoop[s.guardState]; ok {
+			result.loopStart = s.steps
+			around = append(append([]tracedState{}, around[i:]...), around[:i]...)
+			break
+		}
+	}
+	for i, s := range around {
+		if len(result.cycle) == 0 || s.location != result.cycle[len(result.cycle)-1] {
+			result.cycle = append(result.cycle, s.location)
+		}
+		next := around[(i+1)%len(around)]
+		if next.location == s.location && next.direction != s.direction {
+			result.turns = append(result.turns, Turn{s.location, s.direction, next.direction})
+		}
+	}
+	if len(result.cycle) > 1 && result.cycle[len(result.cycle)-1] == result.cycle[0] {
+		// back where the loop was entered
+		result.cycle = result.cycle[:len(result.cycle)-1]
+	}
+	return result
+}
+
+// loops returns true if the guard gets stuck in a loop, treating end as an extra obstruction
+func (p *patroller) loops(l Location, d Direction, end Location) bool {
+	looped, _ := p.walk(l, d, end, nil)
+	return looped
+}
+
+// walk jumps the guard from stop to stop until it leaves the map, returning true if it
+// gets stuck in a loop instead, and the number of steps taken
+//
+// The runs walked and stops reached are recorded in t, if not nil.
+// The temporary obstruction at end is checked against each jump rather than added to the grid,
+// so the grid can be shared between patrollers.
+func (p *patroller) walk(l Location, d Direction, end Location, t *trace) (bool, int) {
+	if _, ok := p.policy.(WallFollowingPolicy); ok {
+		return p.crawl(l, d, end, t)
+	}
+	defer p.resetReached()
+
+	g := p.grid
+	if _, onMap := g.index(l); !onMap {
+		return false, 0
+	}
+	endX, endY := end.x-g.minX, end.y-g.minY
+	if _, onMap := g.index(end); !onMap {
+		// a pretend obstruction off the map can never be hit
+		endX, endY = -1, -1
+	}
+
+	// setup the guard, its positions are tracked by the patroller rather than a PositionMap
+	guard := &Guard{location: l, direction: d, policy: p.policy}
+	steps := 0
+	for {
+		x, y := guard.location.x-g.minX, guard.location.y-g.minY
+		next, found := g.next(x, y, guard.direction)
+		next, found = p.obstruct(next, found, x, y, endX, endY, guard.direction)
+
+		// how far can the guard walk before it stops, or walks off the map
+		var n int
+		switch guard.direction {
+		case DirectionUp:
+			n = y + 1
+			if found {
+				n = y - next.at
+			}
+		case DirectionRight:
+			n = g.width - x
+			if found {
+				n = next.at - x
+			}
+		case DirectionDown:
+			n = g.height - y
+			if found {
+				n = next.at - y
+			}
+		case DirectionLeft:
+			n = x + 1
+			if found {
+				n = x - next.at
+			}
+		}
+		if t != nil {
+			t.runs = append(t.runs, run{x, y, guard.direction, n})
+		}
+
+		// jump up to the stop, or the edge of the map
+		x, y = jump(x, y, guard.direction, n-1)
+		steps += n - 1
+		if !found || next.id == noSpace {
+			// off the map
+			return false, steps
+		}
+		guard.Move(Location{x + g.minX, y + g.minY})
+
+		// if dejavu return true (for loop detection)
+		reached := (next.id*4+int(guard.direction))*p.policy.States() + guard.policyState
+		if p.reached.has(reached) {
+			if t != nil {
+				t.loop = t.first[reached]
+			}
+			return true, steps
+		}
+		p.reached.set(reached)
+		p.touched = append(p.touched, reached)
+
+		// let the space decide where the guard goes
+		before, stepsBefore := *guard, steps
+		x, y = step(x, y, guard.direction)
+		steps += g.behaviour(next.id).Enter(guard, Location{x + g.minX, y + g.minY})
+		if t != nil {
+			t.first[reached] = len(t.stops)
+			t.stops = append(t.stops, reachedStop{before, stepsBefore, *guard, steps, true})
+		}
+	}
+}
+
+// crawl steps the guard one location at a time until it leaves the map, returning true if it
+// gets stuck in a loop instead, and the number of steps taken
+//
+// A guard following a wall can turn without reaching a stop, so every position is remembered
+// rather than just the stops reached. Each position is recorded in t, if not nil, as a run of one
+// location followed by a stop.
+func (p *patroller) crawl(l Location, d Direction, end Location, t *trace) (bool, int) {
+	g := p.grid
+	states := p.policy.States()
+	positions := newBitset(g.width * g.height * 4 * states)
+	obstruction := func(l Location) bool { return l == end }
+
+	guard := &Guard{location: l, direction: d, policy: p.policy}
+	steps := 0
+	for {
+		i, onMap := g.index(guard.location)
+		if !onMap {
+			return false, steps
+		}
+		if t != nil {
+			t.runs = append(t.runs, run{guard.location.x - g.minX, guard.location.y - g.minY, guard.direction, 1})
+		}
+
+		// if dejavu return true (for loop detection)
+		position := (i*4+int(guard.direction))*states + guard.policyState
+		if positions.has(position) {
+			if t != nil {
+				t.loop = t.first[position]
+			}
+			return true, steps
+		}
+		positions.set(position)
+
+		before, stepsBefore := *guard, steps
+		taken, stepped := g.act(guard, obstruction)
+		steps += taken
+		if t != nil {
+			t.first[position] = len(t.stops)
+			t.stops = append(t.stops, reachedStop{before, stepsBefore, *guard, steps, stepped})
+		}
+	}
+}
+
+// obstruct returns the temporary obstruction at endX, endY as the next stop if it is closer
+// than the next stop in the grid
+func (p *patroller) obstruct(next stop, found bool, x, y, endX, endY int, d Direction) (stop, bool) {
+	temporary := stop{id: len(p.grid.spaces)}
+	switch d {
+	case DirectionUp:
+		temporary.at = endY
+		if endX != x || endY >= y || (found && endY <= next.at) {
+			return next, found
+		}
+	case DirectionRight:
+		temporary.at = endX
+		if endY != y || endX <= x || (found && endX >= next.at) {
+			return next, found
+		}
+	case DirectionDown:
+		temporary.at = endY
+		if endX != x || endY <= y || (found && endY >= next.at) {
+			return next, found
+		}
+	case DirectionLeft:
+		temporary.at = endX
+		if endY != y || endX >= x || (found && endX <= next.at) {
+			return next, found
+		}
+	}
+	return temporary, true
+}
+
+// resetReached clears the stops reached, touching only the bits that were set
+func (p *patroller) resetReached() {
+	for _, reached := range p.touched {
+		p.reached[reached/64] = 0
+	}
+	p.touched = p.touched[:0]
+}
+
+// step returns the coordinates one step from x, y in the direction
+func step(x, y int, d Direction) (int, int) {
+	return jump(x, y, d, 1)
+}
+
+// jump returns the coordinates n steps from x, y in the direction
+func jump(x, y int, d Direction, n int) (int, int) {
+	switch d {
+	case DirectionUp:
+		return x, y - n
+	case DirectionRight:
+		return x + n, y
+	case DirectionDown:
+		return x, y + n
+	default:
+		return x - n, y
+	}
+}
+
+// bitset is a compact set of small non-negative integers
+type bitset []uint64
+
+// newBitset creates a bitset that can hold the integers 0 to n-1
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+// set adds i to the set
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+// has returns true if i is in the set
+func (b bitset) has(i int) bool {
+	return b[i/64]&(1<<(i%64)) != 0
+}
+
+// clear empties the set
+func (b bitset) clear() {
+	for i := range b {
+		b[i] = 0
 	}
 }
 
 // Space represents a space on the map
 type Space int
 
+// SolventTankExtraSteps is how many extra steps it takes to wade through a tank of universal solvent
+const SolventTankExtraSteps = 2
+
+// SpaceBehaviour represents how a space affects a guard trying to step into it
+type SpaceBehaviour interface {
+	// Enter moves or turns a guard stepping into the space at the location,
+	// returning the number of steps taken
+	Enter(g *Guard, l Location) int
+}
+
+// FreeSpace lets the guard step into it
+type FreeSpace struct{}
+
+// Enter moves the guard into the space
+func (FreeSpace) Enter(g *Guard, l Location) int {
+	g.Move(l)
+	return 1
+}
+
+// Crates block the guard, which turns (right, unless it has another turn policy)
+type Crates struct{}
+
+// Enter turns the guard without moving, using its turn policy
+func (Crates) Enter(g *Guard, l Location) int {
+	g.turn()
+	return 0
+}
+
+// PolymerSpool blocks the guard, which turns left
+type PolymerSpool struct{}
+
+// Enter turns the guard left without moving
+func (PolymerSpool) Enter(g *Guard, l Location) int {
+	g.turnLeft()
+	return 0
+}
+
+// SolventTank lets the guard wade through it, taking extra steps
+type SolventTank struct {
+	extraSteps int
+}
+
+// Enter moves the guard into the tank
+func (t SolventTank) Enter(g *Guard, l Location) int {
+	g.Move(l)
+	return 1 + t.extraSteps
+}
+
+// SuitPrototypes teleport the guard to the paired suit prototype, still facing the same way
+type SuitPrototypes struct {
+	pairs map[Location]Location
+}
+
+// Enter moves the guard to the paired suit prototype
+//
+// An unpaired suit prototype lets the guard step into it.
+func (s SuitPrototypes) Enter(g *Guard, l Location) int {
+	if pair, ok := s.pairs[l]; ok {
+		l = pair
+	}
+	g.Move(l)
+	return 1
+}
+
+// Behaviours returns the behaviour of each type of space on the map
+//
+// Suit prototypes are paired in reading order (top to bottom, left to right), the first with
+// the second, the third with the fourth and so on. ErrInvalidPatrolMapInput is returned,
+// along with the behaviours, if one is left unpaired.
+func (pm PatrolMap) Behaviours() (map[Space]SpaceBehaviour, error) {
+	suits := []Location{}
+	for l, space := range pm {
+		if space == SpaceFailedSuitPrototypes {
+			suits = append(suits, l)
+		}
+	}
+	sortLocations(suits)
+
+	pairs := make(map[Location]Location)
+	for i := 0; i+1 < len(suits); i += 2 {
+		pairs[suits[i]], pairs[suits[i+1]] = suits[i+1], suits[i]
+	}
+
+	behaviours := map[Space]SpaceBehaviour{
+		SpaceFree:                    FreeSpace{},
+		SpaceFailedSuitPrototypes:    SuitPrototypes{pairs},
+		SpaceSpoolOfVeryLongPolymers: PolymerSpool{},
+		SpaceCrates:                  Crates{},
+		SpaceTankOfUniversalSolvent:  SolventTank{SolventTankExtraSteps},
+	}
+	if len(suits)%2 != 0 {
+		last := suits[len(suits)-1]
+		return behaviours, fmt.Errorf("%w: unpaired suit prototype at %d,%d", ErrInvalidPatrolMapInput, last.x, last.y)
+	}
+	return behaviours, nil
+}
+
 func main() {
 	// Open the input file
 	input, err := os.Open("input.txt")
@@ -241,15 +1931,21 @@ func main() {
 	visitedPositions := patrolMap.Patrol(startLocation, startDirection, Location{-1, -1})
 
 	// count the number of locations visited for part 1
-	log.Printf("(PART 1) The guard visited %d distinct locations", len(visitedPositions))
+	log.Printf("(PART 1) The guard visited %d distinct locations", visitedPositions.Visited().Len())
 
-	// Loop through every step we took to get through the map and see if we can add an obstruction
-	// to create a loop
-	part2 := 0
-	for visitedLocation := range visitedPositions {
-		if patrolMap.Patrol(startLocation, startDirection, visitedLocation) == nil {
-			part2++
-		}
+	// Try an obstruction at every location we went through to get through the map
+	// and see if it creates a loop
+	obstructions, err := patrolMap.FindLoopObstructions(context.Background(), startLocation, startDirection)
+	if err != nil {
+		log.Fatalf("could not search for obstructions: %v", err)
+	}
+	log.Printf("(PART 2) We could add %d obstructions to create a loop", len(obstructions))
+
+	// report the obstructions that make the biggest and smallest loops
+	if longest, shortest, ok := patrolMap.LoopExtremes(startLocation, startDirection, obstructions); ok {
+		log.Printf("(PART 2) The longest loop is %d steps with an obstruction at %d,%d",
+			longest.CycleLength(), longest.Obstruction().X(), longest.Obstruction().Y())
+		log.Printf("(PART 2) The shortest loop is %d steps with an obstruction at %d,%d",
+			shortest.CycleLength(), shortest.Obstruction().X(), shortest.Obstruction().Y())
 	}
-	log.Printf("(PART 2) We could add %d obstructions to create a loop", part2)
 }
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"image"
+	"image/gif"
 	"io"
+	"sort"
 	"strings"
 	"testing"
 
@@ -175,23 +180,23 @@ func TestDay6_Guard_turnRight(t *testing.T) {
 	}{
 		{
 			name:     "up to right",
-			guard:    &Guard{PositionMap{}, Location{0, 0}, DirectionUp},
-			expected: &Guard{PositionMap{}, Location{0, 0}, DirectionRight},
+			guard:    &Guard{positionsVisited: PositionMap{}, location: Location{0, 0}, direction: DirectionUp},
+			expected: &Guard{positionsVisited: PositionMap{}, location: Location{0, 0}, direction: DirectionRight},
 		},
 		{
 			name:     "right to down",
-			guard:    &Guard{PositionMap{}, Location{0, 0}, DirectionRight},
-			expected: &Guard{PositionMap{}, Location{0, 0}, DirectionDown},
+			guard:    &Guard{positionsVisited: PositionMap{}, location: Location{0, 0}, direction: DirectionRight},
+			expected: &Guard{positionsVisited: PositionMap{}, location: Location{0, 0}, direction: DirectionDown},
 		},
 		{
 			name:     "down to left",
-			guard:    &Guard{PositionMap{}, Location{0, 0}, DirectionDown},
-			expected: &Guard{PositionMap{}, Location{0, 0}, DirectionLeft},
+			guard:    &Guard{positionsVisited: PositionMap{}, location: Location{0, 0}, direction: DirectionDown},
+			expected: &Guard{positionsVisited: PositionMap{}, location: Location{0, 0}, direction: DirectionLeft},
 		},
 		{
 			name:     "left to up",
-			guard:    &Guard{PositionMap{}, Location{0, 0}, DirectionLeft},
-			expected: &Guard{PositionMap{}, Location{0, 0}, DirectionUp},
+			guard:    &Guard{positionsVisited: PositionMap{}, location: Location{0, 0}, direction: DirectionLeft},
+			expected: &Guard{positionsVisited: PositionMap{}, location: Location{0, 0}, direction: DirectionUp},
 		},
 	}
 	for _, test := range tests {
@@ -235,9 +240,56 @@ func TestDay6_PatrolMap_ParsePatrolMap(t *testing.T) {
 				Location{0, 0}: SpaceFree, Location{1, 0}: SpaceFree,
 				Location{0, 1}: SpaceFree, Location{1, 1}: SpaceCrates,
 			},
-			expectedGuard: &Guard{PositionMap{}, Location{1, 0}, DirectionUp},
+			expectedGuard: &Guard{positionsVisited: PositionMap{}, location: Location{1, 0}, direction: DirectionUp},
 			expectedErr:   nil,
 		},
+		{
+			name:          "valid input guard right",
+			input:         ">.",
+			expectedMap:   PatrolMap{Location{0, 0}: SpaceFree, Location{1, 0}: SpaceFree},
+			expectedGuard: &Guard{positionsVisited: PositionMap{}, location: Location{0, 0}, direction: DirectionRight},
+			expectedErr:   nil,
+		},
+		{
+			name:          "valid input guard down",
+			input:         ".\nv",
+			expectedMap:   PatrolMap{Location{0, 0}: SpaceFree, Location{0, 1}: SpaceFree},
+			expectedGuard: &Guard{positionsVisited: PositionMap{}, location: Location{0, 1}, direction: DirectionDown},
+			expectedErr:   nil,
+		},
+		{
+			name:          "valid input first of two guards",
+			input:         "#<\n^.",
+			expectedMap:   PatrolMap{Location{0, 0}: SpaceCrates, Location{1, 0}: SpaceFree, Location{0, 1}: SpaceFree, Location{1, 1}: SpaceFree},
+			expectedGuard: &Guard{positionsVisited: PositionMap{}, location: Location{1, 0}, direction: DirectionLeft},
+			expectedErr:   nil,
+		},
+		{
+			name:        "unknown space",
+			input:       ".^\n.x",
+			expectedErr: ErrInvalidPatrolMapInput,
+		},
+		{
+			name:  "valid input behaviourful spaces",
+			input: "%@\n~^\n.%",
+			expectedMap: PatrolMap{
+				Location{0, 0}: SpaceFailedSuitPrototypes, Location{1, 0}: SpaceSpoolOfVeryLongPolymers,
+				Location{0, 1}: SpaceTankOfUniversalSolvent, Location{1, 1}: SpaceFree,
+				Location{0, 2}: SpaceFree, Location{1, 2}: SpaceFailedSuitPrototypes,
+			},
+			expectedGuard: &Guard{positionsVisited: PositionMap{}, location: Location{1, 1}, direction: DirectionUp},
+			expectedErr:   nil,
+		},
+		{
+			name:        "unpaired suit prototype",
+			input:       "%^\n.%\n%.",
+			expectedErr: ErrInvalidPatrolMapInput,
+		},
+		{
+			name:        "missing guard",
+			input:       "..\n.#",
+			expectedErr: ErrInvalidGuardInput,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -337,18 +389,619 @@ func TestDay6_Patrol(t *testing.T) {
 			// move the guard until it leaves the map
 			visitedPositions := patrolMap.Patrol(startLocation, startDirection, Location{-1, -1})
 
-			assert.Equal(t, test.expectedVisited, len(visitedPositions))
+			assert.Equal(t, test.expectedVisited, visitedPositions.Visited().Len())
 
 			// Part2
 			loops := 0
-			for visitedPosition := range visitedPositions {
-				if patrolMap.Patrol(startLocation, startDirection, visitedPosition) == nil {
+			prepared := patrolMap.Prepare()
+			for _, visitedPosition := range visitedPositions.Visited().Locations() {
+				if prepared.Patrol(startLocation, startDirection, visitedPosition).Looped() {
 					loops++
 				}
 			}
 
 			// compare loops to correct solution
 			assert.Equal(t, test.expectedLoops, loops)
+
+			// the parallel search should find the same obstructions
+			obstructions, err := patrolMap.FindLoopObstructions(context.Background(), startLocation, startDirection)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedLoops, len(obstructions))
+		})
+	}
+}
+
+func TestDay6_PatrolMap_FindLoopObstructions(t *testing.T) {
+	t.Run("deterministic order", func(t *testing.T) {
+		patrolMap, guard, _ := ParseInput(strings.NewReader(partTwoPatrolMap))
+		obstructions, err := patrolMap.FindLoopObstructions(context.Background(), guard.location, guard.direction)
+		assert.NoError(t, err)
+		assert.Equal(t, []Location{{3, 6}, {6, 7}, {7, 7}, {1, 8}, {3, 8}, {7, 9}}, obstructions)
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		patrolMap, guard, _ := ParseInput(strings.NewReader(partTwoPatrolMap))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		obstructions, err := patrolMap.FindLoopObstructions(ctx, guard.location, guard.direction)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, obstructions)
+	})
+}
+
+func TestDay6_Visited_Contains(t *testing.T) {
+	patrolMap, guard, _ := ParseInput(strings.NewReader(".#.\n.^.\n..."))
+	visited := patrolMap.Patrol(guard.location, guard.direction, Location{-1, -1}).Visited()
+
+	tests := []struct {
+		name     string
+		location Location
+		expected bool
+	}{
+		{"start", Location{1, 1}, true},
+		{"turned right", Location{2, 1}, true},
+		{"obstruction", Location{1, 0}, false},
+		{"not reached", Location{0, 2}, false},
+		{"off map", Location{5, 5}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, visited.Contains(test.location))
+		})
+	}
+}
+
+func TestDay6_patrolGrid_next(t *testing.T) {
+	patrolMap, _, _ := ParseInput(strings.NewReader("..#..\n.....\n#.^.#\n.....\n..#.."))
+	delete(patrolMap, Location{1, 2})
+	grid := newPatrolGrid(patrolMap)
+
+	tests := []struct {
+		name      string
+		location  Location
+		direction Direction
+		expected  stop
+		found     bool
+	}{
+		{"obstacle up", Location{2, 2}, DirectionUp, stop{at: 0}, true},
+		{"obstacle down", Location{2, 2}, DirectionDown, stop{at: 4}, true},
+		{"obstacle right", Location{2, 2}, DirectionRight, stop{at: 4}, true},
+		{"hole left", Location{2, 2}, DirectionLeft, stop{at: 1, id: noSpace}, true},
+		{"edge", Location{3, 2}, DirectionUp, stop{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next, found := grid.next(test.location.x, test.location.y, test.direction)
+			assert.Equal(t, test.found, found)
+			assert.Equal(t, test.expected.at, next.at)
+			if test.expected.id == noSpace {
+				assert.Equal(t, noSpace, next.id)
+			}
+		})
+	}
+}
+
+func TestDay6_patrolGrid_set(t *testing.T) {
+	patrolMap, _, _ := ParseInput(strings.NewReader("..#..\n.....\n#.^.#\n.....\n..#.."))
+	grid := newPatrolGrid(patrolMap)
+	spaces := len(grid.spaces)
+
+	tests := []struct {
+		name     string
+		location Location
+		space    Space
+	}{
+		{"add crates", Location{1, 2}, SpaceCrates},
+		{"change crates", Location{1, 2}, SpaceSpoolOfVeryLongPolymers},
+		{"remove obstacle", Location{2, 0}, SpaceFree},
+		{"add crates in a column", Location{2, 3}, SpaceCrates},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grid.set(test.location, test.space)
+			patrolMap[test.location] = test.space
+
+			// the stops should be the same as a grid built from the changed map
+			expected := newPatrolGrid(patrolMap)
+			for y := range expected.rows {
+				for x := range expected.cols {
+					want, wantOK := expected.next(x, y, DirectionRight)
+					got, gotOK := grid.next(x, y, DirectionRight)
+					assert.Equal(t, wantOK, gotOK)
+					assert.Equal(t, want.at, got.at)
+					want, wantOK = expected.next(x, y, DirectionDown)
+					got, gotOK = grid.next(x, y, DirectionDown)
+					assert.Equal(t, wantOK, gotOK)
+					assert.Equal(t, want.at, got.at)
+					assert.Equal(t, expected.behaviourAt(Location{x, y}), grid.behaviourAt(Location{x, y}))
+				}
+			}
+		})
+	}
+
+	// undoing the last space added reuses its id
+	grid.set(Location{2, 3}, SpaceFree)
+	assert.Equal(t, spaces+1, len(grid.spaces))
+}
+
+func TestDay6_PreparedMap_Patrol(t *testing.T) {
+	patrolMap, guard, _ := ParseInput(strings.NewReader(partTwoPatrolMap))
+	prepared := patrolMap.Prepare()
+
+	// changes made after preparing the map are not seen
+	patrolMap[Location{4, 5}] = SpaceCrates
+	assert.Equal(t, 41, prepared.Patrol(guard.location, guard.direction, Location{-1, -1}).Visited().Len())
+	assert.True(t, prepared.Patrol(guard.location, guard.direction, Location{3, 6}).Looped())
+}
+
+func TestDay6_patroller_obstruct(t *testing.T) {
+	patrolMap, _, _ := ParseInput(strings.NewReader("..#..\n.....\n..^..\n.....\n....."))
+	p := newPatroller(newPatrolGrid(patrolMap), TurnRight{})
+
+	tests := []struct {
+		name      string
+		end       Location
+		direction Direction
+		expected  stop
+		found     bool
+	}{
+		{"closer than obstacle", Location{2, 1}, DirectionUp, stop{at: 1, id: 1}, true},
+		{"behind obstacle", Location{2, 0}, DirectionDown, stop{}, false},
+		{"behind guard", Location{2, 3}, DirectionUp, stop{at: 0, id: 0}, true},
+		{"no obstacle", Location{4, 2}, DirectionRight, stop{at: 4, id: 1}, true},
+		{"other row", Location{4, 3}, DirectionRight, stop{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next, found := p.grid.next(2, 2, test.direction)
+			next, found = p.obstruct(next, found, 2, 2, test.end.x, test.end.y, test.direction)
+			assert.Equal(t, test.found, found)
+			assert.Equal(t, test.expected, next)
+		})
+	}
+}
+
+func TestDay6_PatrolMap_Patrol_Large(t *testing.T) {
+	const size = 1000
+	patrolMap := make(PatrolMap, size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			patrolMap[Location{x, y}] = SpaceFree
+		}
+	}
+	patrolMap[Location{500, 0}] = SpaceCrates
+	start := Location{500, size - 1}
+
+	// up the column and right along the second row
+	visited := patrolMap.Patrol(start, DirectionUp, Location{-1, -1}).Visited()
+	assert.Equal(t, (size-1)+(size-501), visited.Len())
+
+	// boxed in by two more crates and the pretend obstruction
+	patrolMap[Location{size - 1, 1}] = SpaceCrates
+	patrolMap[Location{499, size - 2}] = SpaceCrates
+	assert.True(t, patrolMap.Patrol(start, DirectionUp, Location{size - 2, size - 1}).Looped())
+}
+
+func TestDay6_patroller_Patrol_Sparse(t *testing.T) {
+	// far too big for a PatrolMap, the guard has to jump between the few crates
+	const size = 10000
+	grid := newSparsePatrolGrid(size, []Location{{5000, 0}, {size - 1, 1}})
+	start := Location{5000, size - 1}
+	p := newPatroller(grid, TurnRight{})
+
+	// up the column, right along the second row and down off the bottom
+	result := p.patrol(start, DirectionUp, Location{-1, -1})
+	assert.True(t, result.Exited())
+	assert.Equal(t, Location{size - 2, size - 1}, result.Exit())
+	assert.Equal(t, (size-2)+(size-5002)+(size-2), result.Steps())
+	assert.Equal(t, (size-1)+(size-5002)+(size-2), result.Visited().Len())
+
+	// no single obstruction on the way up traps the guard
+	for y := 1; y < size-1; y++ {
+		assert.False(t, p.loops(start, DirectionUp, Location{5000, y}))
+	}
+
+	// two more crates turn the guard back up the column it started in, a thousand steps in
+	grid = newSparsePatrolGrid(size, []Location{{5000, 0}, {size - 1, 1}, {size - 2, 9000}, {4999, 8999}})
+	result = newPatroller(grid, TurnRight{}).patrol(start, DirectionUp, Location{-1, -1})
+	assert.True(t, result.Looped())
+	assert.Equal(t, 1000, result.LoopStart())
+	assert.Equal(t, 2*(8998+4998), result.CycleLength())
+}
+
+// newSparsePatrolGrid creates a size by size patrolGrid of free space with crates at the locations,
+// without building a PatrolMap of every location
+func newSparsePatrolGrid(size int, crates []Location) *patrolGrid {
+	g := &patrolGrid{
+		width:      size,
+		height:     size,
+		onMap:      newBitset(size * size),
+		rows:       make([][]stop, size),
+		cols:       make([][]stop, size),
+		behaviours: map[Space]SpaceBehaviour{SpaceCrates: Crates{}},
+	}
+	for i := range g.onMap {
+		g.onMap[i] = ^uint64(0)
+	}
+	for _, l := range sortLocations(crates) {
+		g.addStop(l.x, l.y, len(g.spaces))
+		g.spaces = append(g.spaces, SpaceCrates)
+	}
+	for _, col := range g.cols {
+		sort.Slice(col, func(i, j int) bool { return col[i].at < col[j].at })
+	}
+	return g
+}
+
+func TestDay6_ParseInputGuards(t *testing.T) {
+	_, guards, err := ParseInputGuards(strings.NewReader(".v.\n<.>\n.^."))
+	assert.NoError(t, err)
+	assert.Equal(t, []*Guard{
+		{positionsVisited: PositionMap{}, location: Location{1, 0}, direction: DirectionDown},
+		{positionsVisited: PositionMap{}, location: Location{0, 1}, direction: DirectionLeft},
+		{positionsVisited: PositionMap{}, location: Location{2, 1}, direction: DirectionRight},
+		{positionsVisited: PositionMap{}, location: Location{1, 2}, direction: DirectionUp},
+	}, guards)
+}
+
+func TestDay6_PatrolMap_PatrolTogether(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		collision Collision
+		expected  []int
+	}{
+		{"single guard", partTwoPatrolMap, CollisionBlock, []int{41}},
+		{"single guard loop", ".#..\n...#\n#^..\n..#.", CollisionHalt, []int{-1}},
+		{"pass through", ".....\n..v..\n.....\n..^..\n.....", CollisionPassThrough, []int{4, 4}},
+		{"block", ".....\n..v..\n.....\n..^..\n.....", CollisionBlock, []int{4, 3}},
+		{"halt meeting", ".....\n..v..\n.....\n..^..\n.....", CollisionHalt, []int{2, 2}},
+		{"halt swapping", ".....\n..v..\n..^..\n.....", CollisionHalt, []int{2, 2}},
+		{"halt on halted guard", "..v..\n>....\n..^..", CollisionHalt, []int{2, 3, 2}},
+		{"one loops one leaves", ".#..\n...#\n#^..\n..#.\n...>", CollisionPassThrough, []int{-1, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patrolMap, guards, err := ParseInputGuards(strings.NewReader(test.input))
+			assert.NoError(t, err)
+
+			visited := patrolMap.PatrolTogether(guards, test.collision)
+			counts := []int{}
+			for _, v := range visited {
+				if v == nil {
+					counts = append(counts, -1)
+				} else {
+					counts = append(counts, v.Len())
+				}
+			}
+			assert.Equal(t, test.expected, counts)
+		})
+	}
+}
+
+func TestDay6_SpaceBehaviour_Enter(t *testing.T) {
+	tests := []struct {
+		name          string
+		behaviour     SpaceBehaviour
+		expectedGuard *Guard
+		expectedSteps int
+	}{
+		{"free space", FreeSpace{}, &Guard{location: Location{1, 0}, direction: DirectionRight}, 1},
+		{"crates", Crates{}, &Guard{location: Location{0, 0}, direction: DirectionDown}, 0},
+		{"polymer spool", PolymerSpool{}, &Guard{location: Location{0, 0}, direction: DirectionUp}, 0},
+		{"solvent tank", SolventTank{2}, &Guard{location: Location{1, 0}, direction: DirectionRight}, 3},
+		{"suit prototypes", SuitPrototypes{map[Location]Location{{1, 0}: {5, 5}}}, &Guard{location: Location{5, 5}, direction: DirectionRight}, 1},
+		{"unpaired suit prototype", SuitPrototypes{}, &Guard{location: Location{1, 0}, direction: DirectionRight}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guard := &Guard{location: Location{0, 0}, direction: DirectionRight}
+			steps := test.behaviour.Enter(guard, Location{1, 0})
+			assert.Equal(t, test.expectedGuard, guard)
+			assert.Equal(t, test.expectedSteps, steps)
+		})
+	}
+}
+
+func TestDay6_PatrolMap_Patrol_Behaviours(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		expectedVisited int
+		expectedSteps   int
+		expectedLoop    bool
+	}{
+		{"polymer spool turns left", "..@..\n.....\n..^..", 4, 3, false},
+		{"solvent tank costs extra steps", ".~.\n.^.", 2, 3, false},
+		{"suit prototypes teleport", "..>.%\n%....", 7, 6, false},
+		{"suit prototypes loop without turning", "%.>.%", 0, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patrolMap, guard, err := ParseInput(strings.NewReader(test.input))
+			assert.NoError(t, err)
+
+			// jumping between stops and stepping together should agree
+			result := patrolMap.Patrol(guard.location, guard.direction, Location{-1, -1})
+			together := patrolMap.PatrolTogether([]*Guard{guard}, CollisionPassThrough)[0]
+			assert.Equal(t, test.expectedLoop, result.Looped())
+			if test.expectedLoop {
+				assert.Nil(t, together)
+				return
+			}
+			for _, visited := range []*Visited{result.Visited(), together} {
+				assert.Equal(t, test.expectedVisited, visited.Len())
+				assert.Equal(t, test.expectedSteps, visited.Steps())
+			}
+		})
+	}
+}
+
+func TestDay6_PatrolMap_Patrol_Result(t *testing.T) {
+	patrolMap, guard, _ := ParseInput(strings.NewReader(partTwoPatrolMap))
+
+	t.Run("exited", func(t *testing.T) {
+		result := patrolMap.Patrol(guard.location, guard.direction, Location{-1, -1})
+		assert.True(t, result.Exited())
+		assert.False(t, result.Looped())
+		assert.Equal(t, Location{7, 9}, result.Exit())
+		assert.Equal(t, 44, result.Steps())
+		assert.Equal(t, result.Steps(), patrolMap.PatrolTogether([]*Guard{guard}, CollisionPassThrough)[0].Steps())
+	})
+
+	t.Run("looped", func(t *testing.T) {
+		result := patrolMap.Patrol(guard.location, guard.direction, Location{3, 6})
+		assert.True(t, result.Looped())
+		assert.False(t, result.Exited())
+		// the guard starts on the loop, and realises it once it is back at the first crate it turned at
+		assert.Equal(t, 0, result.LoopStart())
+		assert.Equal(t, 23, result.Steps())
+		assert.Equal(t, 18, result.CycleLength())
+		assert.Equal(t, []Location{
+			{4, 6}, {4, 5}, {4, 4}, {4, 3}, {4, 2},
+			{4, 1}, {5, 1}, {6, 1}, {7, 1}, {8, 1},
+			{8, 2}, {8, 3}, {8, 4}, {8, 5}, {8, 6},
+			{7, 6}, {6, 6}, {5, 6},
+		}, result.Cycle())
+		assert.Equal(t, []Turn{
+			{Location{4, 1}, DirectionUp, DirectionRight},
+			{Location{8, 1}, DirectionRight, DirectionDown},
+			{Location{8, 6}, DirectionDown, DirectionLeft},
+			{Location{4, 6}, DirectionLeft, DirectionUp},
+		}, result.Turns())
+	})
+}
+
+func TestDay6_PatrolMap_LoopExtremes(t *testing.T) {
+	patrolMap, guard, _ := ParseInput(strings.NewReader(partTwoPatrolMap))
+
+	obstructions, _ := patrolMap.FindLoopObstructions(context.Background(), guard.location, guard.direction)
+	longest, shortest, ok := patrolMap.LoopExtremes(guard.location, guard.direction, obstructions)
+	assert.True(t, ok)
+	assert.Equal(t, Location{3, 8}, longest.Obstruction())
+	assert.Equal(t, Location{6, 7}, shortest.Obstruction())
+	assert.Greater(t, longest.CycleLength(), shortest.CycleLength())
+
+	_, _, ok = patrolMap.LoopExtremes(guard.location, guard.direction, []Location{{0, 0}})
+	assert.False(t, ok)
+}
+
+func TestDay6_TurnPolicy_Turn(t *testing.T) {
+	tests := []struct {
+		name              string
+		policy            TurnPolicy
+		state             int
+		expectedDirection Direction
+		expectedState     int
+	}{
+		{"turn right", TurnRight{}, 0, DirectionRight, 0},
+		{"turn left", TurnLeft{}, 0, DirectionLeft, 0},
+		{"alternate left first", TurnAlternate{}, 0, DirectionLeft, 1},
+		{"alternate right second", TurnAlternate{}, 1, DirectionRight, 0},
+		{"turn around", TurnAround{}, 0, DirectionDown, 0},
+		{"right hand wall", RightHandWall{}, rightHandFree, DirectionLeft, rightHandOnWall},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			direction, state := test.policy.Turn(DirectionUp, test.state)
+			assert.Equal(t, test.expectedDirection, direction)
+			assert.Equal(t, test.expectedState, state)
+		})
+	}
+}
+
+func TestDay6_RightHandWall_Follow(t *testing.T) {
+	tests := []struct {
+		name              string
+		state             int
+		rightBlocked      bool
+		expectedDirection Direction
+		expectedState     int
+	}{
+		{"walking free", rightHandFree, false, DirectionUp, rightHandFree},
+		{"wall continues", rightHandOnWall, true, DirectionUp, rightHandOnWall},
+		{"wall ends", rightHandOnWall, false, DirectionRight, rightHandRoundingCorner},
+		{"rounding corner", rightHandRoundingCorner, false, DirectionUp, rightHandOnWall},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			direction, state := RightHandWall{}.Follow(DirectionUp, test.state, test.rightBlocked)
+			assert.Equal(t, test.expectedDirection, direction)
+			assert.Equal(t, test.expectedState, state)
+		})
+	}
+}
+
+func TestDay6_Guard_DejaVu_TurnPolicy(t *testing.T) {
+	guard := NewGuard(Location{0, 0}, DirectionUp)
+	guard.SetTurnPolicy(TurnAlternate{})
+	guard.AddVisitedPosition()
+	assert.True(t, guard.DejaVu())
+
+	// same position, but the guard will turn the other way next time
+	guard.policyState = 1
+	assert.False(t, guard.DejaVu())
+}
+
+func TestDay6_PatrolMap_PatrolWithPolicy(t *testing.T) {
+	tests := []struct {
+		name              string
+		input             string
+		policy            TurnPolicy
+		expectedVisited   int
+		expectedSteps     int
+		expectedLoopStart int
+		expectedCycle     int
+	}{
+		{"turn right", partTwoPatrolMap, TurnRight{}, 41, 44, 0, 0},
+		{"turn around", partTwoPatrolMap, TurnAround{}, 9, 13, 0, 0},
+		{"turn left", partTwoPatrolMap, TurnLeft{}, 10, 9, 0, 0},
+		{"alternate", partTwoPatrolMap, TurnAlternate{}, 10, 9, 0, 0},
+		{"right hand wall in a box", "#####\n#...#\n#.^.#\n#####", RightHandWall{}, 6, 7, 1, 6},
+		{"right hand wall round a block", ".....\n.##..\n.##..\n..^..", RightHandWall{}, 12, 12, 0, 12},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patrolMap, guard, _ := ParseInput(strings.NewReader(test.input))
+			result := patrolMap.PatrolWithPolicy(guard.location, guard.direction, Location{-1, -1}, test.policy)
+			assert.Equal(t, test.expectedVisited, result.Visited().Len())
+			assert.Equal(t, test.expectedSteps, result.Steps())
+			assert.Equal(t, test.expectedLoopStart, result.LoopStart())
+			assert.Equal(t, test.expectedCycle, result.CycleLength())
+			assert.Equal(t, test.expectedCycle, len(result.Cycle()))
+
+			// stepping with the guard's own policy should agree
+			guard.SetTurnPolicy(test.policy)
+			together := patrolMap.PatrolTogether([]*Guard{guard}, CollisionPassThrough)[0]
+			if test.expectedCycle > 0 {
+				assert.Nil(t, together)
+				return
+			}
+			assert.Equal(t, result.Visited().Len(), together.Len())
+			assert.Equal(t, result.Steps(), together.Steps())
+		})
+	}
+}
+
+func TestDay6_PatrolResult_Events(t *testing.T) {
+	patrolMap, guard, _ := ParseInput(strings.NewReader(".#.\n...\n.^."))
+	result := patrolMap.Patrol(guard.location, guard.direction, Location{-1, -1})
+
+	assert.Equal(t, []Event{
+		{kind: EventMove, steps: 1, location: Location{1, 1}, direction: DirectionUp},
+		{kind: EventObstruction, steps: 1, location: Location{1, 1}, direction: DirectionUp, obstruction: Location{1, 0}},
+		{kind: EventTurn, steps: 1, location: Location{1, 1}, direction: DirectionRight},
+		{kind: EventMove, steps: 2, location: Location{2, 1}, direction: DirectionRight},
+		{kind: EventMove, steps: 2, location: Location{3, 1}, direction: DirectionRight},
+	}, result.Events())
+
+	t.Run("following a wall", func(t *testing.T) {
+		patrolMap, guard, _ := ParseInput(strings.NewReader(".....\n.##..\n.##..\n..^.."))
+		result := patrolMap.PatrolWithPolicy(guard.location, guard.direction, Location{-1, -1}, RightHandWall{})
+
+		// turning round a corner is not caused by an obstruction
+		kinds := map[EventKind]int{}
+		for _, event := range result.Events() {
+			kinds[event.Kind()]++
+		}
+		assert.Equal(t, map[EventKind]int{EventMove: 12, EventObstruction: 1, EventTurn: 5}, kinds)
+	})
+}
+
+func TestDay6_PatrolMap_RenderFrames(t *testing.T) {
+	patrolMap, guard, _ := ParseInput(strings.NewReader(partTwoPatrolMap))
+	result := patrolMap.Patrol(guard.location, guard.direction, Location{-1, -1})
+
+	frames := patrolMap.RenderFrames(result)
+	assert.Equal(t, len(result.Events())+1, len(frames))
+	assert.Equal(t, strings.TrimSpace(partTwoPatrolMap), frames[0])
+	assert.Equal(t, "....#.....\n"+
+		"....XXXXX#\n"+
+		"....X...X.\n"+
+		"..#.X...X.\n"+
+		"..XXXXX#X.\n"+
+		"..X.X.X.X.\n"+
+		".#XXXXXXX.\n"+
+		".XXXXXXX#.\n"+
+		"#XXXXXXX..\n"+
+		"......#X..", frames[len(frames)-1])
+}
+
+func TestDay6_PatrolMap_RenderTrails(t *testing.T) {
+	patrolMap, guard, _ := ParseInput(strings.NewReader(partTwoPatrolMap))
+	result := patrolMap.Patrol(guard.location, guard.direction, Location{3, 6})
+
+	assert.Equal(t, "....#.....\n"+
+		"....+---+#\n"+
+		"....|...|.\n"+
+		"..#.|...|.\n"+
+		"....|..#|.\n"+
+		"....|...|.\n"+
+		".#.O^---+.\n"+
+		"........#.\n"+
+		"#.........\n"+
+		"......#...", patrolMap.RenderTrails(result))
+}
+
+func TestDay6_PatrolMap_WriteGIF(t *testing.T) {
+	patrolMap, guard, _ := ParseInput(strings.NewReader(partTwoPatrolMap))
+	result := patrolMap.Patrol(guard.location, guard.direction, Location{3, 6})
+
+	var buf bytes.Buffer
+	assert.NoError(t, patrolMap.WriteGIF(&buf, result, 4))
+
+	anim, err := gif.DecodeAll(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, len(result.Events())+1, len(anim.Image))
+	assert.Equal(t, image.Rect(0, 0, 40, 40), anim.Image[0].Bounds())
+}
+
+func TestDay6_PatrolMap_MinObstructionsAvoiding(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		target     Location
+		k          int
+		expected   []Location
+		expectedOk bool
+	}{
+		{"never reached", partTwoPatrolMap, Location{0, 0}, 0, []Location{}, true},
+		{"not enough obstructions", partTwoPatrolMap, Location{7, 9}, 0, nil, false},
+		{"one obstruction", partTwoPatrolMap, Location{7, 9}, 2, []Location{{4, 5}}, true},
+		{"start", partTwoPatrolMap, Location{4, 6}, 2, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patrolMap, guard, _ := ParseInput(strings.NewReader(test.input))
+			obstructions, ok := patrolMap.MinObstructionsAvoiding(guard.location, guard.direction, test.target, test.k)
+			assert.Equal(t, test.expected, obstructions)
+			assert.Equal(t, test.expectedOk, ok)
+
+			// the map is left alone
+			assert.Equal(t, Space(SpaceFree), patrolMap[Location{4, 5}])
+		})
+	}
+}
+
+func TestDay6_PatrolMap_MinCratesToFree(t *testing.T) {
+	boxed := "#######\n#######\n##...##\n##.^.##\n##...##\n#######\n#######"
+	tests := []struct {
+		name       string
+		input      string
+		k          int
+		expected   []Location
+		expectedOk bool
+	}{
+		{"already free", partTwoPatrolMap, 0, []Location{}, true},
+		{"one crate", "###\n#^#\n###", 1, []Location{{1, 0}}, true},
+		{"not enough crates", boxed, 1, nil, false},
+		{"two crates", boxed, 3, []Location{{3, 0}, {3, 1}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patrolMap, guard, _ := ParseInput(strings.NewReader(test.input))
+			crates, ok := patrolMap.MinCratesToFree(guard.location, guard.direction, test.k)
+			assert.Equal(t, test.expected, crates)
+			assert.Equal(t, test.expectedOk, ok)
 		})
 	}
 }
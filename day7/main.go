@@ -2,8 +2,11 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"regexp"
 	"strconv"
@@ -14,10 +17,20 @@ const (
 	REGEX_EQUATION = `^(\d+):\s*(\d+(?:\s+\d+)*)+$`
 )
 
+var (
+	ErrOverflow = errors.New("number overflows")
+)
+
 // Operator represents an operator that can perform operations on numbers
 type Operator interface {
-	Evaluate(left, right Number) Number
+	// Evaluate returns the result of the operation, and ErrOverflow if it is too large for a Number
+	Evaluate(left, right Number) (Number, error)
 	EvaluateMultiple(left []Number, right Number) []Number
+	// Inverse returns the left number that evaluates to the result with the right number,
+	// and false if there is no such number
+	Inverse(result, right Number) (Number, bool)
+	// String returns the symbol for the operator
+	String() string
 }
 
 // AdditionOperator represents an operator that can perform additions
@@ -29,17 +42,31 @@ func NewAdditionOperator() *AdditionOperator {
 }
 
 // Evaluate performs an addition operation on two numbers
-func (a AdditionOperator) Evaluate(left, right Number) Number {
-	return NewNumber(left.value + right.value)
+func (a AdditionOperator) Evaluate(left, right Number) (Number, error) {
+	if (right.value > 0 && left.value > math.MaxInt-right.value) ||
+		(right.value < 0 && left.value < math.MinInt-right.value) {
+		return Number{}, fmt.Errorf("%w: %v + %v", ErrOverflow, left, right)
+	}
+	return NewNumber(left.value + right.value), nil
 }
 
-// EvaluateMultiple performs all addition operations on a list of inputs and returns the multiple results
+// EvaluateMultiple performs all addition operations on a list of inputs and returns the multiple results,
+// leaving out any that overflow
 func (a AdditionOperator) EvaluateMultiple(left []Number, right Number) []Number {
-	var results []Number
-	for _, number := range left {
-		results = append(results, a.Evaluate(number, right))
+	return evaluateMultiple(a, left, right)
+}
+
+// Inverse performs a subtraction, as long as the result is at least the right number
+func (a AdditionOperator) Inverse(result, right Number) (Number, bool) {
+	if result.value < right.value {
+		return Number{}, false
 	}
-	return results
+	return NewNumber(result.value - right.value), true
+}
+
+// String returns "+"
+func (a AdditionOperator) String() string {
+	return "+"
 }
 
 // ConcatenationOperator represents an operator that can perform concatenations
@@ -51,19 +78,43 @@ func NewConcatenationOperator() *ConcatenationOperator {
 }
 
 // Evaluate performs a concatenation operation on two numbers
-func (c ConcatenationOperator) Evaluate(left, right Number) Number {
+func (c ConcatenationOperator) Evaluate(left, right Number) (Number, error) {
 	result := left.String() + right.String()
-	i, _ := strconv.Atoi(result)
-	return NewNumber(i)
+	i, err := strconv.Atoi(result)
+	if errors.Is(err, strconv.ErrRange) {
+		return Number{}, fmt.Errorf("%w: %v || %v", ErrOverflow, left, right)
+	}
+	if err != nil {
+		return Number{}, err
+	}
+	return NewNumber(i), nil
 }
 
-// EvaluateMultiple performs all concatenation operations on a list of inputs and returns the multiple results
+// EvaluateMultiple performs all concatenation operations on a list of inputs and returns the multiple results,
+// leaving out any that overflow
 func (c ConcatenationOperator) EvaluateMultiple(left []Number, right Number) []Number {
-	var results []Number
-	for _, number := range left {
-		results = append(results, c.Evaluate(number, right))
+	return evaluateMultiple(c, left, right)
+}
+
+// Inverse strips the right number from the end of the result, as long as something is left
+func (c ConcatenationOperator) Inverse(result, right Number) (Number, bool) {
+	suffix := 10
+	for right.value >= suffix {
+		// a result ending in right would need more digits than a Number can hold
+		if suffix > math.MaxInt/10 {
+			return Number{}, false
+		}
+		suffix *= 10
 	}
-	return results
+	if result.value <= right.value || result.value%suffix != right.value {
+		return Number{}, false
+	}
+	return NewNumber(result.value / suffix), true
+}
+
+// String returns "||"
+func (c ConcatenationOperator) String() string {
+	return "||"
 }
 
 // MultiplcationOperator represents an operator that can perform multiplications
@@ -75,15 +126,40 @@ func NewMultiplicationOperator() *MultiplcationOperator {
 }
 
 // Evaluate performs a multiplication operation on two numbers
-func (m MultiplcationOperator) Evaluate(left, right Number) Number {
-	return NewNumber(left.value * right.value)
+func (m MultiplcationOperator) Evaluate(left, right Number) (Number, error) {
+	result := left.value * right.value
+	if left.value != 0 && (result/left.value != right.value || (left.value == -1 && right.value == math.MinInt)) {
+		return Number{}, fmt.Errorf("%w: %v * %v", ErrOverflow, left, right)
+	}
+	return NewNumber(result), nil
 }
 
-// EvaluateMultiple performs all multiplication operations on a list of inputs and returns the multiple results
+// EvaluateMultiple performs all multiplication operations on a list of inputs and returns the multiple results,
+// leaving out any that overflow
 func (m MultiplcationOperator) EvaluateMultiple(left []Number, right Number) []Number {
+	return evaluateMultiple(m, left, right)
+}
+
+// Inverse performs an exact division, as long as the right number is not zero
+func (m MultiplcationOperator) Inverse(result, right Number) (Number, bool) {
+	if right.value == 0 || result.value%right.value != 0 {
+		return Number{}, false
+	}
+	return NewNumber(result.value / right.value), true
+}
+
+// String returns "*"
+func (m MultiplcationOperator) String() string {
+	return "*"
+}
+
+// evaluateMultiple performs the operation on each of the left numbers, leaving out any results that overflow
+func evaluateMultiple(op Operator, left []Number, right Number) []Number {
 	var results []Number
 	for _, number := range left {
-		results = append(results, m.Evaluate(number, right))
+		if result, err := op.Evaluate(number, right); err == nil {
+			results = append(results, result)
+		}
 	}
 	return results
 }
@@ -92,42 +168,306 @@ func (m MultiplcationOperator) EvaluateMultiple(left []Number, right Number) []N
 type Equation struct {
 	testValue Number
 	numbers   map[int]Number
+	mode      EvaluationMode
 }
 
 // NewEquation creates a new Equation
 func NewEquation(testValue Number, numbers map[int]Number) *Equation {
-	return &Equation{testValue, numbers}
+	return &Equation{testValue: testValue, numbers: numbers}
+}
+
+// SetEvaluationMode sets the order the operators of the equation are applied in
+func (e *Equation) SetEvaluationMode(mode EvaluationMode) {
+	e.mode = mode
+}
+
+// EvaluationMode returns the order the operators of the equation are applied in,
+// left to right unless set otherwise
+func (e Equation) EvaluationMode() EvaluationMode {
+	if e.mode == nil {
+		return LeftToRight{}
+	}
+	return e.mode
 }
 
 // EvaluateTrue evaluates the equation and returns true if the test value is possible
 // to be made with the given operators
 func (e Equation) EvaluateTrue(operators []Operator) bool {
-	var combined []Number
-	for i := 0; i < len(e.numbers); i++ {
-		if combined == nil {
-			combined = []Number{e.numbers[i]}
+	_, ok := e.Solve(operators)
+	return ok
+}
+
+// Solve returns the first sequence of operators found that makes the test value,
+// and false if there is none
+func (e Equation) Solve(operators []Operator) (Solution, bool) {
+	var solution Solution
+	found := false
+	e.solutions(operators, func(s Solution) bool {
+		solution, found = s, true
+		return false
+	})
+	return solution, found
+}
+
+// AllSolutions returns every sequence of operators that makes the test value,
+// more than one means the equation is ambiguous
+func (e Equation) AllSolutions(operators []Operator) []Solution {
+	solutions := []Solution{}
+	e.solutions(operators, func(s Solution) bool {
+		solutions = append(solutions, s)
+		return true
+	})
+	return solutions
+}
+
+// solutions passes each sequence of operators that makes the test value to found,
+// until found returns false
+//
+// The equation is worked right to left from the test value, undoing each operator with its inverse,
+// so only the combinations that can still work are tried. Any other evaluation mode tries
+// every combination.
+//
+// Working forwards, a combination that overflows is larger than any test value and is discarded.
+// Working backwards only makes numbers smaller, so cannot overflow.
+func (e Equation) solutions(operators []Operator, found func(Solution) bool) {
+	numbers := make([]Number, len(e.numbers))
+	for i := range numbers {
+		numbers[i] = e.numbers[i]
+	}
+	chosen := make([]Operator, max(len(numbers)-1, 0))
+	emit := func() bool {
+		return found(Solution{numbers, append([]Operator{}, chosen...)})
+	}
+
+	if _, ok := e.EvaluationMode().(LeftToRight); !ok {
+		e.solveExhaustive(operators, numbers, 0, chosen, emit)
+		return
+	}
+	e.solveBackward(operators, e.testValue, len(numbers)-1, chosen, emit)
+}
+
+// solveBackward chooses the operators before each number up to i that make the target,
+// returning false once emit asks to stop
+//
+// An inverse only gives one left number, but a left number of zero might also work (0 || 5 is 5),
+// or with a right number of zero any left number might (anything multiplied by zero is zero),
+// so then the numbers before are worked forwards instead, to find every left number that works.
+func (e Equation) solveBackward(operators []Operator, target Number, i int, chosen []Operator, emit func() bool) bool {
+	if i <= 0 {
+		if len(e.numbers) > 0 && target.value == e.numbers[0].value {
+			return emit()
+		}
+		return true
+	}
+	for _, op := range operators {
+		chosen[i-1] = op
+		if left, ok := op.Inverse(target, e.numbers[i]); ok {
+			if !e.solveBackward(operators, left, i-1, chosen, emit) {
+				return false
+			}
+			continue
+		}
+		if !e.zeroMightWork(op, target, i) {
 			continue
 		}
-		var newCombined []Number
-		for _, op := range operators {
-			opResult := op.EvaluateMultiple(combined, e.numbers[i])
-			newCombined = append(newCombined, opResult...)
+		if !e.solveForward(operators, e.numbers[0], 1, i, chosen, func(left Number) bool {
+			if result, err := op.Evaluate(left, e.numbers[i]); err != nil || result.value != target.value {
+				return true
+			}
+			return emit()
+		}) {
+			return false
 		}
-		combined = newCombined
 	}
-	for _, result := range combined {
-		if e.testValue.value == result.value {
+	return true
+}
+
+// zeroMightWork returns true if the operator makes the target from a left number of zero and the right
+// number at i, and the numbers before i might make zero: either any left number works, or there is
+// a zero amongst them (the operators only make zero from a zero)
+func (e Equation) zeroMightWork(op Operator, target Number, i int) bool {
+	if zero, err := op.Evaluate(Number{}, e.numbers[i]); err != nil || zero.value != target.value {
+		return false
+	}
+	if one, err := op.Evaluate(NewNumber(1), e.numbers[i]); err == nil && one.value == target.value {
+		return true
+	}
+	for j := 0; j < i; j++ {
+		if e.numbers[j].value == 0 {
 			return true
 		}
 	}
 	return false
 }
 
+// solveForward chooses the operators before each number from i up to end, passing each value made
+// from the value so far to reached, returning false once reached asks to stop
+func (e Equation) solveForward(operators []Operator, value Number, i, end int, chosen []Operator, reached func(Number) bool) bool {
+	if i >= end {
+		return reached(value)
+	}
+	for _, op := range operators {
+		next, err := op.Evaluate(value, e.numbers[i])
+		if err != nil {
+			continue
+		}
+		chosen[i-1] = op
+		if !e.solveForward(operators, next, i+1, end, chosen, reached) {
+			return false
+		}
+	}
+	return true
+}
+
 // TestValue returns the test value of the equation
 func (e Equation) TestValue() Number {
 	return e.testValue
 }
 
+// solveExhaustive chooses every operator from i onwards, evaluating each complete combination
+// with the equation's evaluation mode, returning false once emit asks to stop
+func (e Equation) solveExhaustive(operators []Operator, numbers []Number, i int, chosen []Operator, emit func() bool) bool {
+	if i >= len(chosen) {
+		if len(numbers) == 0 {
+			return true
+		}
+		result, err := e.EvaluationMode().Evaluate(numbers, chosen)
+		if err == nil && result.value == e.testValue.value {
+			return emit()
+		}
+		return true
+	}
+	for _, op := range operators {
+		chosen[i] = op
+		if !e.solveExhaustive(operators, numbers, i+1, chosen, emit) {
+			return false
+		}
+	}
+	return true
+}
+
+// EvaluationMode represents the order that the operators of an equation are applied in
+type EvaluationMode interface {
+	// Evaluate returns the result of the numbers with the operators between them,
+	// and ErrOverflow if any operation is too large for a Number
+	Evaluate(numbers []Number, operators []Operator) (Number, error)
+}
+
+// LeftToRight evaluates the operators strictly left to right, as the calibration engineers do
+type LeftToRight struct{}
+
+// Evaluate applies each operator in turn to the result so far
+func (l LeftToRight) Evaluate(numbers []Number, operators []Operator) (Number, error) {
+	result := numbers[0]
+	for i, op := range operators {
+		var err error
+		if result, err = op.Evaluate(result, numbers[i+1]); err != nil {
+			return Number{}, err
+		}
+	}
+	return result, nil
+}
+
+// Precedence evaluates the operators with the highest level first,
+// operators with the same level are evaluated left to right
+//
+// Levels are kept by the operator's symbol, so any operator with the same symbol has the same level.
+type Precedence struct {
+	levels map[string]int
+}
+
+// NewPrecedence creates a new Precedence from the level of each operator,
+// any operator not given has a level of 0
+func NewPrecedence(levels map[Operator]int) Precedence {
+	symbols := make(map[string]int, len(levels))
+	for op, level := range levels {
+		symbols[op.String()] = level
+	}
+	return Precedence{symbols}
+}
+
+// NewStandardPrecedence creates a new Precedence where multiplication binds tighter than addition,
+// with concatenation at the given level (0 below addition, 1 with addition, 2 with multiplication,
+// 3 above multiplication)
+func NewStandardPrecedence(concatenation int) Precedence {
+	return NewPrecedence(map[Operator]int{
+		NewAdditionOperator():       1,
+		NewMultiplicationOperator(): 2,
+		NewConcatenationOperator():  concatenation,
+	})
+}
+
+// Level returns the level of the operator
+func (p Precedence) Level(op Operator) int {
+	return p.levels[op.String()]
+}
+
+// Evaluate applies the operators in order of level, keeping the numbers and operators still
+// to be applied on stacks so that a lower operator waits for any higher ones after it
+func (p Precedence) Evaluate(numbers []Number, operators []Operator) (Number, error) {
+	values := []Number{numbers[0]}
+	pending := []Operator{}
+	apply := func() error {
+		op := pending[len(pending)-1]
+		left, right := values[len(values)-2], values[len(values)-1]
+		result, err := op.Evaluate(left, right)
+		if err != nil {
+			return err
+		}
+		pending = pending[:len(pending)-1]
+		values = append(values[:len(values)-2], result)
+		return nil
+	}
+
+	for i, op := range operators {
+		for len(pending) > 0 && p.Level(pending[len(pending)-1]) >= p.Level(op) {
+			if err := apply(); err != nil {
+				return Number{}, err
+			}
+		}
+		pending = append(pending, op)
+		values = append(values, numbers[i+1])
+	}
+	for len(pending) > 0 {
+		if err := apply(); err != nil {
+			return Number{}, err
+		}
+	}
+	return values[0], nil
+}
+
+// Solution represents the operators that make an equation true, one between each pair of numbers
+type Solution struct {
+	numbers   []Number
+	operators []Operator
+}
+
+// Operators returns the operators, in order
+func (s Solution) Operators() []Operator {
+	return s.operators
+}
+
+// String returns the numbers with the operators between them, for example "81 + 40 * 27"
+func (s Solution) String() string {
+	var b strings.Builder
+	for i, number := range s.numbers {
+		if i > 0 {
+			b.WriteString(" " + s.operators[i-1].String() + " ")
+		}
+		b.WriteString(number.String())
+	}
+	return b.String()
+}
+
+// parseInt parses a number from the input, returning ErrOverflow if it is too large for a Number
+func parseInt(s string) (int, error) {
+	i, err := strconv.Atoi(s)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("%w: %s", ErrOverflow, s)
+	}
+	return i, err
+}
+
 // Number represents any number used in an equation
 type Number struct {
 	value int
@@ -170,11 +510,9 @@ func main() {
 	operators = append(operators, NewMultiplicationOperator())
 
 	// Evaluate the equations
-	calibrationTotal := 0
-	for _, equation := range equations {
-		if equation.EvaluateTrue(operators) {
-			calibrationTotal += equation.TestValue().Int()
-		}
+	calibrationTotal, err := CalibrationTotal(equations, operators)
+	if err != nil {
+		log.Fatalf("could not total the calibration results: %v", err)
 	}
 
 	log.Println("(Part 1) Total Calibration Result: ", calibrationTotal)
@@ -183,16 +521,30 @@ func main() {
 	operators = append(operators, NewConcatenationOperator())
 
 	// Re-evaluate the equations
-	calibrationTotal = 0
-	for _, equation := range equations {
-		if equation.EvaluateTrue(operators) {
-			calibrationTotal += equation.TestValue().Int()
-		}
+	calibrationTotal, err = CalibrationTotal(equations, operators)
+	if err != nil {
+		log.Fatalf("could not total the calibration results: %v", err)
 	}
 
 	log.Println("(Part 2) Total Calibration Result: ", calibrationTotal)
 }
 
+// CalibrationTotal returns the sum of the test values of the equations that can be made true
+// with the operators, and ErrOverflow if the sum is too large for a Number
+func CalibrationTotal(equations []*Equation, operators []Operator) (Number, error) {
+	total := NewNumber(0)
+	for _, equation := range equations {
+		if !equation.EvaluateTrue(operators) {
+			continue
+		}
+		var err error
+		if total, err = NewAdditionOperator().Evaluate(total, equation.TestValue()); err != nil {
+			return Number{}, err
+		}
+	}
+	return total, nil
+}
+
 func ParseEquations(input io.Reader) ([]*Equation, error) {
 	equations := make([]*Equation, 0)
 
@@ -202,14 +554,14 @@ func ParseEquations(input io.Reader) ([]*Equation, error) {
 	scanner := bufio.NewScanner(input)
 	for scanner.Scan() {
 		values := regexEquation.FindStringSubmatch(scanner.Text())
-		testValueRaw, err := strconv.Atoi(values[1])
+		testValueRaw, err := parseInt(values[1])
 		if err != nil {
 			return nil, err
 		}
 		numbers := make(map[int]Number, len(values[2]))
 		numbersRaw := strings.Split(values[2], " ")
 		for i := range numbersRaw {
-			n, err := strconv.Atoi(numbersRaw[i])
+			n, err := parseInt(numbersRaw[i])
 			if err != nil {
 				return nil, err
 			}
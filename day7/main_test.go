@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math"
 	"strings"
 	"testing"
 
@@ -190,7 +191,8 @@ func TestDay7_AdditionOperator_Evaluate(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			op := NewAdditionOperator()
-			actual := op.Evaluate(test.left, test.right)
+			actual, err := op.Evaluate(test.left, test.right)
+			assert.NoError(t, err)
 			assert.Equal(t, test.expected, actual)
 		})
 	}
@@ -235,7 +237,8 @@ func TestDay7_ConcatenationOperator_Evaluate(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			op := NewConcatenationOperator()
-			actual := op.Evaluate(test.left, test.right)
+			actual, err := op.Evaluate(test.left, test.right)
+			assert.NoError(t, err)
 			assert.Equal(t, test.expected, actual)
 		})
 	}
@@ -280,7 +283,8 @@ func TestDay7_MultiplicationOperator_Evaluate(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			op := NewMultiplicationOperator()
-			actual := op.Evaluate(test.left, test.right)
+			actual, err := op.Evaluate(test.left, test.right)
+			assert.NoError(t, err)
 			assert.Equal(t, test.expected, actual)
 		})
 	}
@@ -353,3 +357,475 @@ func TestDay7_ParseInput(t *testing.T) {
 		})
 	}
 }
+
+func TestDay7_Operator_Inverse(t *testing.T) {
+	tests := []struct {
+		name       string
+		operator   Operator
+		result     Number
+		right      Number
+		expected   Number
+		expectedOk bool
+	}{
+		{"subtraction", NewAdditionOperator(), Number{46}, Number{34}, Number{12}, true},
+		{"subtraction below zero", NewAdditionOperator(), Number{12}, Number{34}, Number{}, false},
+		{"division", NewMultiplicationOperator(), Number{408}, Number{34}, Number{12}, true},
+		{"inexact division", NewMultiplicationOperator(), Number{409}, Number{34}, Number{}, false},
+		{"division by zero", NewMultiplicationOperator(), Number{0}, Number{0}, Number{}, false},
+		{"suffix stripping", NewConcatenationOperator(), Number{1234}, Number{34}, Number{12}, true},
+		{"suffix stripping powers of ten", NewConcatenationOperator(), Number{1210}, Number{10}, Number{12}, true},
+		{"suffix missing", NewConcatenationOperator(), Number{1235}, Number{34}, Number{}, false},
+		{"nothing left after stripping", NewConcatenationOperator(), Number{34}, Number{34}, Number{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, ok := test.operator.Inverse(test.result, test.right)
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.expectedOk, ok)
+		})
+	}
+}
+
+func TestDay7_Equation_EvaluateTrue_Sample(t *testing.T) {
+	sample := "" +
+		"190: 10 19\n" +
+		"3267: 81 40 27\n" +
+		"83: 17 5\n" +
+		"156: 15 6\n" +
+		"7290: 6 8 6 15\n" +
+		"161011: 16 10 13\n" +
+		"192: 17 8 14\n" +
+		"21037: 9 7 18 13\n" +
+		"292: 11 6 16 20\n"
+	equations, err := ParseEquations(strings.NewReader(sample))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		operators []Operator
+		expected  int
+	}{
+		{"part one", []Operator{NewAdditionOperator(), NewMultiplicationOperator()}, 3749},
+		{"part two", []Operator{NewAdditionOperator(), NewMultiplicationOperator(), NewConcatenationOperator()}, 11387},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			total := 0
+			for _, equation := range equations {
+				// working backwards should agree with working forwards
+				forward := false
+				end := len(equation.numbers)
+				equation.solveForward(test.operators, equation.numbers[0], 1, end, make([]Operator, end-1), func(value Number) bool {
+					forward = value == equation.TestValue()
+					return !forward
+				})
+				assert.Equal(t, forward, equation.EvaluateTrue(test.operators))
+				if equation.EvaluateTrue(test.operators) {
+					total += equation.TestValue().Int()
+				}
+			}
+			assert.Equal(t, test.expected, total)
+		})
+	}
+}
+
+func TestDay7_Equation_EvaluateTrue_Long(t *testing.T) {
+	// 3^29 combinations going forwards, but odd test values are pruned straight away going backwards
+	numbers := make(map[int]Number)
+	for i := 0; i < 30; i++ {
+		numbers[i] = Number{2}
+	}
+	operators := []Operator{NewAdditionOperator(), NewMultiplicationOperator(), NewConcatenationOperator()}
+
+	assert.True(t, NewEquation(Number{60}, numbers).EvaluateTrue(operators))
+	assert.False(t, NewEquation(Number{61}, numbers).EvaluateTrue(operators))
+
+	// a zero only sends the numbers before it forwards, and only when the target is zero there
+	numbers[27] = Number{0}
+	assert.True(t, NewEquation(Number{4}, numbers).EvaluateTrue(operators))
+	assert.False(t, NewEquation(Number{61}, numbers).EvaluateTrue(operators))
+	numbers[27], numbers[2] = Number{2}, Number{0}
+	assert.True(t, NewEquation(Number{4}, numbers).EvaluateTrue(operators))
+	assert.False(t, NewEquation(Number{65}, numbers).EvaluateTrue(operators))
+}
+
+func TestDay7_Equation_EvaluateTrue_Zero(t *testing.T) {
+	// multiplying by zero cannot be undone, so these are evaluated forwards
+	operators := []Operator{NewAdditionOperator(), NewMultiplicationOperator()}
+	assert.True(t, NewEquation(Number{0}, map[int]Number{0: {5}, 1: {0}}).EvaluateTrue(operators))
+	assert.True(t, NewEquation(Number{3}, map[int]Number{0: {5}, 1: {0}, 2: {3}}).EvaluateTrue(operators))
+
+	// 0 || 5 is 5, which cannot be undone by stripping 5 off the end of 5
+	concatenation := []Operator{NewConcatenationOperator()}
+	assert.True(t, NewEquation(Number{5}, map[int]Number{0: {0}, 1: {5}}).EvaluateTrue(concatenation))
+}
+
+func TestDay7_Equation_EvaluateTrue_ZeroForwards(t *testing.T) {
+	// working backwards should agree with working forwards, whichever operators are used
+	equations := smallEquations()
+	for _, operators := range operatorSets() {
+		for _, equation := range equations {
+			forward := false
+			end := len(equation.numbers)
+			equation.solveForward(operators, equation.numbers[0], 1, end, make([]Operator, end-1), func(value Number) bool {
+				forward = value == equation.TestValue()
+				return !forward
+			})
+			assert.Equal(t, forward, equation.EvaluateTrue(operators), "%v %v", operators, equation)
+		}
+	}
+}
+
+// operatorSets returns every non-empty set of the operators
+func operatorSets() [][]Operator {
+	all := []Operator{NewAdditionOperator(), NewMultiplicationOperator(), NewConcatenationOperator()}
+	sets := [][]Operator{}
+	for mask := 1; mask < 1<<len(all); mask++ {
+		set := []Operator{}
+		for i, op := range all {
+			if mask&(1<<i) != 0 {
+				set = append(set, op)
+			}
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+// smallEquations returns every equation of up to four numbers from 0, 1, 5 and 10, for each test value
+// the numbers can make and each one from 0 to 20
+func smallEquations() []*Equation {
+	digits := []int{0, 1, 5, 10}
+	operators := []Operator{NewAdditionOperator(), NewMultiplicationOperator(), NewConcatenationOperator()}
+	equations := []*Equation{}
+	for n := 1; n <= 4; n++ {
+		for i := 0; i < int(math.Pow(float64(len(digits)), float64(n))); i++ {
+			numbers := map[int]Number{}
+			for j, k := 0, i; j < n; j, k = j+1, k/len(digits) {
+				numbers[j] = Number{digits[k%len(digits)]}
+			}
+
+			values := map[int]bool{}
+			for value := 0; value <= 20; value++ {
+				values[value] = true
+			}
+			NewEquation(Number{}, numbers).solveForward(operators, numbers[0], 1, n, make([]Operator, n-1), func(value Number) bool {
+				values[value.value] = true
+				return true
+			})
+			for value := range values {
+				equations = append(equations, NewEquation(Number{value}, numbers))
+			}
+		}
+	}
+	return equations
+}
+
+func TestDay7_Equation_Solve(t *testing.T) {
+	operators := []Operator{NewAdditionOperator(), NewMultiplicationOperator(), NewConcatenationOperator()}
+	tests := []struct {
+		name     string
+		equation *Equation
+		expected string
+		found    bool
+	}{
+		{"single", NewEquation(Number{190}, map[int]Number{0: {10}, 1: {19}}), "10 * 19", true},
+		{"mixed", NewEquation(Number{3267}, map[int]Number{0: {81}, 1: {40}, 2: {27}}), "81 * 40 + 27", true},
+		{"concatenation", NewEquation(Number{7290}, map[int]Number{0: {6}, 1: {8}, 2: {6}, 3: {15}}), "6 * 8 || 6 * 15", true},
+		{"zero", NewEquation(Number{3}, map[int]Number{0: {5}, 1: {0}, 2: {3}}), "5 * 0 + 3", true},
+		{"impossible", NewEquation(Number{83}, map[int]Number{0: {17}, 1: {5}}), "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			solution, found := test.equation.Solve(operators)
+			assert.Equal(t, test.found, found)
+			if found {
+				assert.Equal(t, test.expected, solution.String())
+				assert.Len(t, solution.Operators(), len(test.equation.numbers)-1)
+			}
+		})
+	}
+}
+
+func TestDay7_Equation_AllSolutions(t *testing.T) {
+	operators := []Operator{NewAdditionOperator(), NewMultiplicationOperator()}
+	withConcatenation := append(operators, NewConcatenationOperator())
+	tests := []struct {
+		name      string
+		equation  *Equation
+		operators []Operator
+		expected  []string
+	}{
+		{"ambiguous", NewEquation(Number{3267}, map[int]Number{0: {81}, 1: {40}, 2: {27}}), operators, []string{"81 + 40 * 27", "81 * 40 + 27"}},
+		{"same result", NewEquation(Number{4}, map[int]Number{0: {2}, 1: {2}}), operators, []string{"2 + 2", "2 * 2"}},
+		{"zero", NewEquation(Number{0}, map[int]Number{0: {0}, 1: {5}}), operators, []string{"0 * 5"}},
+		{"impossible", NewEquation(Number{83}, map[int]Number{0: {17}, 1: {5}}), operators, []string{}},
+		{"concatenated onto zero", NewEquation(Number{5}, map[int]Number{0: {3}, 1: {0}, 2: {5}}), withConcatenation, []string{"3 * 0 + 5", "3 * 0 || 5"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			solutions := []string{}
+			for _, solution := range test.equation.AllSolutions(test.operators) {
+				solutions = append(solutions, solution.String())
+			}
+			assert.ElementsMatch(t, test.expected, solutions)
+		})
+	}
+}
+
+func TestDay7_Equation_AllSolutions_Forwards(t *testing.T) {
+	// working backwards should find every solution working forwards does, whichever operators are used,
+	// the zeros being where there can be more than one left number
+	equations := []*Equation{}
+	for _, equation := range smallEquations() {
+		for _, number := range equation.numbers {
+			if number.value == 0 {
+				equations = append(equations, equation)
+				break
+			}
+		}
+	}
+	for _, operators := range operatorSets() {
+		for _, equation := range equations {
+			forward := []string{}
+			end := len(equation.numbers)
+			chosen := make([]Operator, end-1)
+			equation.solveForward(operators, equation.numbers[0], 1, end, chosen, func(value Number) bool {
+				if value == equation.TestValue() {
+					forward = append(forward, Solution{sortedNumbers(equation), chosen}.String())
+				}
+				return true
+			})
+
+			backward := []string{}
+			for _, solution := range equation.AllSolutions(operators) {
+				backward = append(backward, solution.String())
+			}
+			assert.ElementsMatch(t, forward, backward, "%v %v", operators, equation)
+		}
+	}
+}
+
+// sortedNumbers returns the numbers of the equation in order
+func sortedNumbers(e *Equation) []Number {
+	numbers := make([]Number, len(e.numbers))
+	for i := range numbers {
+		numbers[i] = e.numbers[i]
+	}
+	return numbers
+}
+
+func TestDay7_EvaluationMode_Evaluate(t *testing.T) {
+	add, multiply, concatenate := NewAdditionOperator(), NewMultiplicationOperator(), NewConcatenationOperator()
+	numbers := []Number{{2}, {3}, {4}, {5}}
+	tests := []struct {
+		name      string
+		mode      EvaluationMode
+		operators []Operator
+		expected  Number
+	}{
+		{"left to right", LeftToRight{}, []Operator{add, multiply, add}, Number{25}},
+		{"standard", NewStandardPrecedence(0), []Operator{add, multiply, add}, Number{19}},
+		{"standard concatenation lowest", NewStandardPrecedence(0), []Operator{concatenate, multiply, add}, Number{217}},
+		{"standard concatenation highest", NewStandardPrecedence(3), []Operator{concatenate, multiply, add}, Number{97}},
+		{"addition first", NewPrecedence(map[Operator]int{add: 2, multiply: 1}), []Operator{multiply, add, multiply}, Number{70}},
+		{"all the same level", NewPrecedence(nil), []Operator{add, multiply, add}, Number{25}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := test.mode.Evaluate(numbers, test.operators)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestDay7_Precedence_Level(t *testing.T) {
+	precedence := NewStandardPrecedence(3)
+	tests := []struct {
+		name     string
+		operator Operator
+		expected int
+	}{
+		{"constructed addition", NewAdditionOperator(), 1},
+		{"value addition", AdditionOperator{}, 1},
+		{"new multiplication", new(MultiplcationOperator), 2},
+		{"value multiplication", MultiplcationOperator{}, 2},
+		{"value concatenation", ConcatenationOperator{}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, precedence.Level(test.operator))
+		})
+	}
+
+	// the operators evaluated need not be the ones the levels were given with
+	result, err := precedence.Evaluate([]Number{{2}, {3}, {4}}, []Operator{AdditionOperator{}, MultiplcationOperator{}})
+	assert.NoError(t, err)
+	assert.Equal(t, Number{14}, result)
+}
+
+func TestDay7_Equation_EvaluationMode(t *testing.T) {
+	equation := NewEquation(Number{3267}, map[int]Number{0: {81}, 1: {40}, 2: {27}})
+	assert.Equal(t, LeftToRight{}, equation.EvaluationMode())
+
+	equation.SetEvaluationMode(NewStandardPrecedence(0))
+	assert.Equal(t, NewStandardPrecedence(0), equation.EvaluationMode())
+}
+
+func TestDay7_Equation_EvaluateTrue_Modes(t *testing.T) {
+	sample := "" +
+		"190: 10 19\n" +
+		"3267: 81 40 27\n" +
+		"83: 17 5\n" +
+		"156: 15 6\n" +
+		"7290: 6 8 6 15\n" +
+		"161011: 16 10 13\n" +
+		"192: 17 8 14\n" +
+		"21037: 9 7 18 13\n" +
+		"292: 11 6 16 20\n"
+	equations, err := ParseEquations(strings.NewReader(sample))
+	assert.NoError(t, err)
+
+	add, multiply, concatenate := NewAdditionOperator(), NewMultiplicationOperator(), NewConcatenationOperator()
+	tests := []struct {
+		name     string
+		mode     EvaluationMode
+		partOne  int
+		partTwo  int
+		solution string
+	}{
+		{"left to right", LeftToRight{}, 3749, 11387, "81 * 40 + 27"},
+		// 292 relies on adding before multiplying, 7290 and 192 rely on concatenating last
+		{"standard concatenation lowest", NewStandardPrecedence(0), 3457, 3613, "81 * 40 + 27"},
+		// 17 || 8 + 14 still makes 192 when concatenation binds tightest
+		{"standard concatenation highest", NewStandardPrecedence(3), 3457, 3805, "81 * 40 + 27"},
+		{"addition first", NewPrecedence(map[Operator]int{add: 2, multiply: 1}), 3457, 3613, "81 + 40 * 27"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			partOne, partTwo := 0, 0
+			for _, equation := range equations {
+				equation.SetEvaluationMode(test.mode)
+				if equation.EvaluateTrue([]Operator{add, multiply}) {
+					partOne += equation.TestValue().Int()
+				}
+				if equation.EvaluateTrue([]Operator{add, multiply, concatenate}) {
+					partTwo += equation.TestValue().Int()
+				}
+			}
+			assert.Equal(t, test.partOne, partOne)
+			assert.Equal(t, test.partTwo, partTwo)
+
+			// only one reading of 81 40 27 holds outside of left to right
+			solution, found := equations[1].Solve([]Operator{add, multiply})
+			assert.True(t, found)
+			assert.Equal(t, test.solution, solution.String())
+		})
+	}
+}
+
+func TestDay7_Operator_Evaluate_Overflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator Operator
+		left     Number
+		right    Number
+		overflow bool
+	}{
+		{"addition at the limit", NewAdditionOperator(), Number{math.MaxInt - 1}, Number{1}, false},
+		{"addition past the limit", NewAdditionOperator(), Number{math.MaxInt}, Number{1}, true},
+		{"addition below the limit", NewAdditionOperator(), Number{math.MinInt}, Number{-1}, true},
+		{"multiplication at the limit", NewMultiplicationOperator(), Number{math.MaxInt / 7}, Number{7}, false},
+		{"multiplication past the limit", NewMultiplicationOperator(), Number{math.MaxInt/7 + 1}, Number{7}, true},
+		{"multiplication by zero", NewMultiplicationOperator(), Number{math.MaxInt}, Number{0}, false},
+		{"multiplication of the minimum", NewMultiplicationOperator(), Number{-1}, Number{math.MinInt}, true},
+		{"concatenation at the limit", NewConcatenationOperator(), Number{922337203685477580}, Number{7}, false},
+		{"concatenation past the limit", NewConcatenationOperator(), Number{922337203685477580}, Number{8}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.operator.Evaluate(test.left, test.right)
+			if test.overflow {
+				assert.ErrorIs(t, err, ErrOverflow)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	// overflowing results are left out rather than wrapping around
+	assert.Equal(t, []Number{{math.MaxInt}}, NewAdditionOperator().EvaluateMultiple([]Number{{math.MaxInt - 1}, {math.MaxInt}}, Number{1}))
+}
+
+func TestDay7_ConcatenationOperator_Inverse_Large(t *testing.T) {
+	// nothing can end in a number with as many digits as the largest Number
+	_, ok := NewConcatenationOperator().Inverse(Number{math.MaxInt}, Number{math.MaxInt - 1})
+	assert.False(t, ok)
+
+	left, ok := NewConcatenationOperator().Inverse(Number{math.MaxInt}, Number{223372036854775807})
+	assert.True(t, ok)
+	assert.Equal(t, Number{9}, left)
+}
+
+func TestDay7_Equation_EvaluateTrue_Overflow(t *testing.T) {
+	operators := []Operator{NewAdditionOperator(), NewMultiplicationOperator(), NewConcatenationOperator()}
+	tests := []struct {
+		name     string
+		input    string
+		mode     EvaluationMode
+		expected bool
+	}{
+		// wrapping around, 4294967296 * 4294967296 + 5 + 0 would make 5
+		{"multiplied past the limit", "5: 4294967296 4294967296 5 0", LeftToRight{}, false},
+		// failing to parse, 922337203685477580 || 8 + 7 + 0 would make 7
+		{"concatenated past the limit", "7: 922337203685477580 8 7 0", LeftToRight{}, false},
+		{"largest number", "9223372036854775807: 4611686018427387903 2 1", LeftToRight{}, true},
+		{"precedence past the limit", "9223372036854775807: 9223372036854775806 1 4611686018427387904 2", NewStandardPrecedence(0), false},
+		{"precedence at the limit", "9223372036854775807: 9223372036854775806 1 4611686018427387904 0", NewStandardPrecedence(0), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			equations, err := ParseEquations(strings.NewReader(test.input))
+			assert.NoError(t, err)
+			equations[0].SetEvaluationMode(test.mode)
+			assert.Equal(t, test.expected, equations[0].EvaluateTrue(operators))
+		})
+	}
+}
+
+func TestDay7_ParseInput_Overflow(t *testing.T) {
+	_, err := ParseEquations(strings.NewReader("9223372036854775808: 1 2\n"))
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	_, err = ParseEquations(strings.NewReader("3: 1 92233720368547758070\n"))
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestDay7_CalibrationTotal(t *testing.T) {
+	operators := []Operator{NewAdditionOperator(), NewMultiplicationOperator()}
+	tests := []struct {
+		name     string
+		input    string
+		expected Number
+		overflow bool
+	}{
+		{"sample", "190: 10 19\n3267: 81 40 27\n83: 17 5\n", Number{3457}, false},
+		{"largest total", "9223372036854775806: 9223372036854775806\n1: 1\n", Number{math.MaxInt}, false},
+		{"total past the limit", "9223372036854775806: 9223372036854775806\n2: 2\n", Number{}, true},
+		{"false equations are not added", "9223372036854775806: 9223372036854775806\n2: 3\n", Number{math.MaxInt - 1}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			equations, err := ParseEquations(strings.NewReader(test.input))
+			assert.NoError(t, err)
+			total, err := CalibrationTotal(equations, operators)
+			if test.overflow {
+				assert.ErrorIs(t, err, ErrOverflow)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, total)
+		})
+	}
+}